@@ -0,0 +1,259 @@
+// Package api serves the state of the monitored kafka connect clusters as JSON, from the
+// snapshots of their last collection, for dashboards and tooling. It never calls the
+// kafka connect API.
+//
+// The API has the following endpoints:
+//
+//	GET /api/v1/clusters
+//	GET /api/v1/connectors
+//	GET /api/v1/connectors/{name}
+//
+// Responses are objects with the result in "data", or a message in "error". Connectors
+// can be filtered with the cluster, state, task_state, worker, owner and tier query
+// parameters, each of which can be repeated to match any of its values, and with name,
+// a regular expression the connector names must match. Clusters can be filtered with
+// cluster.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/pkg/errors"
+)
+
+// Prefix is the path all the API's endpoints are under.
+const Prefix = "/api/v1/"
+
+// Cluster is a monitored cluster, and the snapshot of its last collection.
+type Cluster struct {
+	Name     string
+	Snapshot prometheus.Snapshot
+}
+
+// Source provides the clusters served by the API.
+type Source interface {
+	Clusters() []Cluster
+}
+
+// Handler serves the API from the clusters of its source.
+type Handler struct {
+	src Source
+}
+
+// NewHandler returns a handler serving the API for the clusters of src.
+func NewHandler(src Source) *Handler {
+	return &Handler{src: src}
+}
+
+// cluster is the summary of a cluster served by the clusters endpoint.
+type cluster struct {
+	Name        string     `json:"name"`
+	CollectedAt *time.Time `json:"collected_at,omitempty"`
+	AgeSeconds  *float64   `json:"age_seconds,omitempty"`
+	Failing     bool       `json:"failing"`
+	Stale       bool       `json:"stale"`
+	Truncated   bool       `json:"truncated"`
+
+	// Connectors and Tasks count the cluster's connectors and tasks by state.
+	Connectors map[string]int `json:"connectors"`
+	Tasks      map[string]int `json:"tasks"`
+}
+
+// connector is a connector served by the connectors endpoints, along with its cluster.
+type connector struct {
+	Cluster     string    `json:"cluster"`
+	CollectedAt time.Time `json:"collected_at"`
+	prometheus.ConnectorSnapshot
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), Prefix)
+	switch {
+	case path == "clusters":
+		h.serveClusters(w, r)
+	case path == "connectors":
+		h.serveConnectors(w, r)
+	case strings.HasPrefix(path, "connectors/"):
+		name, err := url.PathUnescape(strings.TrimPrefix(path, "connectors/"))
+		if err != nil || name == "" {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid connector name %q", path))
+			return
+		}
+		h.serveConnector(w, r, name)
+	default:
+		writeError(w, http.StatusNotFound, errors.Errorf("unknown endpoint %s", r.URL.Path))
+	}
+}
+
+func (h *Handler) serveClusters(w http.ResponseWriter, r *http.Request) {
+	clusters := r.URL.Query()["cluster"]
+	data := []cluster{}
+	for _, c := range h.src.Clusters() {
+		if !matchAny(clusters, c.Name) {
+			continue
+		}
+		snap := c.Snapshot
+		summary := cluster{
+			Name:       c.Name,
+			Failing:    snap.Failing,
+			Stale:      snap.Stale,
+			Truncated:  snap.Truncated,
+			Connectors: make(map[string]int),
+			Tasks:      make(map[string]int),
+		}
+		if !snap.CollectedAt.IsZero() {
+			at, age := snap.CollectedAt, time.Since(snap.CollectedAt).Seconds()
+			summary.CollectedAt, summary.AgeSeconds = &at, &age
+		}
+		for _, conn := range snap.Connectors {
+			summary.Connectors[conn.State]++
+			for _, t := range conn.Tasks {
+				summary.Tasks[t.State]++
+			}
+		}
+		data = append(data, summary)
+	}
+	writeData(w, data)
+}
+
+func (h *Handler) serveConnectors(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data := []connector{}
+	for _, c := range h.src.Clusters() {
+		for _, conn := range c.Snapshot.Connectors {
+			if f.match(c.Name, conn) {
+				data = append(data, connector{c.Name, c.Snapshot.CollectedAt, conn})
+			}
+		}
+	}
+	writeData(w, data)
+}
+
+// serveConnector serves a single connector. If several clusters have a connector of the
+// same name, the cluster must be chosen with the cluster query parameter.
+func (h *Handler) serveConnector(w http.ResponseWriter, r *http.Request, name string) {
+	clusters := r.URL.Query()["cluster"]
+	var found []connector
+	for _, c := range h.src.Clusters() {
+		if !matchAny(clusters, c.Name) {
+			continue
+		}
+		for _, conn := range c.Snapshot.Connectors {
+			if conn.Name == name {
+				found = append(found, connector{c.Name, c.Snapshot.CollectedAt, conn})
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		writeError(w, http.StatusNotFound, errors.Errorf("connector %s not found", name))
+	case 1:
+		writeData(w, found[0])
+	default:
+		names := make([]string, len(found))
+		for i, conn := range found {
+			names[i] = conn.Cluster
+		}
+		writeError(w, http.StatusConflict, errors.Errorf("connector %s is in clusters %s, choose one with the cluster parameter", name, strings.Join(names, ", ")))
+	}
+}
+
+// filter selects connectors. Empty fields match every connector.
+type filter struct {
+	clusters, states, taskStates, workers, owners, tiers []string
+	name                                                 *regexp.Regexp
+}
+
+func parseFilter(query url.Values) (filter, error) {
+	f := filter{
+		clusters:   query["cluster"],
+		states:     query["state"],
+		taskStates: query["task_state"],
+		workers:    query["worker"],
+		owners:     query["owner"],
+		tiers:      query["tier"],
+	}
+	if pattern := query.Get("name"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return f, errors.Wrap(err, "name")
+		}
+		f.name = re
+	}
+	return f, nil
+}
+
+// match reports whether the connector of the named cluster passes the filter. The state
+// filter matches the connector's state, and the task_state filter any of its tasks'. The
+// worker filter matches the connector's worker, or any of its tasks'.
+func (f filter) match(cluster string, conn prometheus.ConnectorSnapshot) bool {
+	if !matchAny(f.clusters, cluster) || !matchAny(f.states, conn.State) {
+		return false
+	}
+	if f.name != nil && !f.name.MatchString(conn.Name) {
+		return false
+	}
+	var owner, tier string
+	if conn.Metadata != nil {
+		owner, tier = conn.Metadata.Owner, conn.Metadata.Tier
+	}
+	if !matchAny(f.owners, owner) || !matchAny(f.tiers, tier) {
+		return false
+	}
+
+	taskState := len(f.taskStates) == 0
+	worker := matchAny(f.workers, conn.WorkerID)
+	for _, t := range conn.Tasks {
+		taskState = taskState || matchAny(f.taskStates, t.State)
+		worker = worker || matchAny(f.workers, t.WorkerID)
+	}
+	return taskState && worker
+}
+
+// matchAny reports whether values is empty, or contains value.
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	write(w, http.StatusOK, struct {
+		Data interface{} `json:"data"`
+	}{data})
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	write(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
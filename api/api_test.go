@@ -0,0 +1,235 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+type staticSource []api.Cluster
+
+func (s staticSource) Clusters() []api.Cluster {
+	return s
+}
+
+func testSource() staticSource {
+	at := time.Now().Add(-time.Minute)
+	return staticSource{
+		{
+			Name: "a",
+			Snapshot: prometheus.Snapshot{
+				CollectedAt: at,
+				Connectors: []prometheus.ConnectorSnapshot{
+					{
+						Name:     "orders",
+						State:    "RUNNING",
+						WorkerID: "w1:8083",
+						Metadata: &metadata.Metadata{Owner: "payments", Tier: "1"},
+						Tasks: []prometheus.TaskSnapshot{
+							{ID: 0, State: "RUNNING", WorkerID: "w1:8083"},
+							{ID: 1, State: "FAILED", WorkerID: "w2:8083", Trace: "boom"},
+						},
+					},
+					{
+						Name:     "users/v2",
+						State:    "PAUSED",
+						WorkerID: "w2:8083",
+						Tasks:    []prometheus.TaskSnapshot{{ID: 0, State: "PAUSED", WorkerID: "w2:8083"}},
+					},
+				},
+			},
+		},
+		{
+			Name: "b",
+			Snapshot: prometheus.Snapshot{
+				CollectedAt: at,
+				Connectors: []prometheus.ConnectorSnapshot{
+					{Name: "orders", State: "RUNNING", WorkerID: "w3:8083"},
+				},
+			},
+		},
+		{
+			Name:     "c",
+			Snapshot: prometheus.Snapshot{Failing: true},
+		},
+	}
+}
+
+type apiTestCase struct {
+	name         string
+	path         string
+	expectStatus int
+
+	// expect lists the clusters and names of the connectors served, or the names of the
+	// clusters.
+	expect []string
+}
+
+func TestHandler(t *testing.T) {
+	testCases := []apiTestCase{
+		{
+			name:         "clusters",
+			path:         "/api/v1/clusters",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a", "b", "c"},
+		},
+		{
+			name:         "all connectors",
+			path:         "/api/v1/connectors",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a/orders", "a/users/v2", "b/orders"},
+		},
+		{
+			name:         "by cluster",
+			path:         "/api/v1/connectors?cluster=b&cluster=c",
+			expectStatus: http.StatusOK,
+			expect:       []string{"b/orders"},
+		},
+		{
+			name:         "by task state",
+			path:         "/api/v1/connectors?task_state=FAILED",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a/orders"},
+		},
+		{
+			name:         "by task worker",
+			path:         "/api/v1/connectors?worker=w2:8083",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a/orders", "a/users/v2"},
+		},
+		{
+			name:         "by owner and name",
+			path:         "/api/v1/connectors?owner=payments&name=^ord",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a/orders"},
+		},
+		{
+			name:         "invalid name pattern",
+			path:         "/api/v1/connectors?name=(",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "escaped connector name",
+			path:         "/api/v1/connectors/users%2Fv2",
+			expectStatus: http.StatusOK,
+			expect:       []string{"a/users/v2"},
+		},
+		{
+			name:         "connector in several clusters",
+			path:         "/api/v1/connectors/orders",
+			expectStatus: http.StatusConflict,
+		},
+		{
+			name:         "connector in chosen cluster",
+			path:         "/api/v1/connectors/orders?cluster=b",
+			expectStatus: http.StatusOK,
+			expect:       []string{"b/orders"},
+		},
+		{
+			name:         "unknown connector",
+			path:         "/api/v1/connectors/missing",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "unknown endpoint",
+			path:         "/api/v1/workers",
+			expectStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc apiTestCase) assert(t *testing.T) {
+	rec := httptest.NewRecorder()
+	api.NewHandler(testSource()).ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+	if rec.Code != tc.expectStatus {
+		t.Fatalf("expected status %d, got %d: %s", tc.expectStatus, rec.Code, rec.Body)
+	}
+
+	var res struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		if res.Error == "" {
+			t.Error("expected an error message")
+		}
+		return
+	}
+
+	type item struct {
+		Cluster string `json:"cluster"`
+		Name    string `json:"name"`
+	}
+	var items []item
+	if res.Data[0] == '{' {
+		items = make([]item, 1)
+		err := json.Unmarshal(res.Data, &items[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else if err := json.Unmarshal(res.Data, &items); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, i := range items {
+		if i.Cluster == "" {
+			got = append(got, i.Name)
+		} else {
+			got = append(got, i.Cluster+"/"+i.Name)
+		}
+	}
+	if !reflect.DeepEqual(got, tc.expect) {
+		t.Errorf("expected %v, got %v", tc.expect, got)
+	}
+}
+
+func TestHandlerClusterSummary(t *testing.T) {
+	rec := httptest.NewRecorder()
+	api.NewHandler(testSource()).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/clusters?cluster=a&cluster=c", nil))
+
+	var res struct {
+		Data []struct {
+			Name        string         `json:"name"`
+			CollectedAt *time.Time     `json:"collected_at"`
+			Failing     bool           `json:"failing"`
+			Connectors  map[string]int `json:"connectors"`
+			Tasks       map[string]int `json:"tasks"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != 2 {
+		t.Fatalf("expected 2 clusters, got %s", rec.Body)
+	}
+	a, c := res.Data[0], res.Data[1]
+	if a.CollectedAt == nil || !reflect.DeepEqual(a.Connectors, map[string]int{"RUNNING": 1, "PAUSED": 1}) ||
+		!reflect.DeepEqual(a.Tasks, map[string]int{"RUNNING": 1, "FAILED": 1, "PAUSED": 1}) {
+		t.Errorf("unexpected summary of cluster a: %s", rec.Body)
+	}
+	if c.CollectedAt != nil || !c.Failing {
+		t.Errorf("unexpected summary of cluster c: %s", rec.Body)
+	}
+}
+
+func TestHandlerMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	api.NewHandler(testSource()).ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/clusters", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
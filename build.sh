@@ -7,7 +7,7 @@ IMAGE=$TRAVIS_REPO_SLUG
 
 echo "Building Binary ..."
 mkdir build dist
-gox -output "build/{{.OS}}_{{.Arch}}/{{.Dir}}"
+gox -ldflags "-X main.version=${RELEASE}" -output "build/{{.OS}}_{{.Arch}}/{{.Dir}}"
 cp build/linux_amd64/${NAME} .
 
 echo "Packaging Binary ..."
@@ -22,7 +22,7 @@ cd $ROOT
 
 if [ "$RELEASE" != "" ]; then
     echo "Building Docker Image ..."
-    docker build -t $IMAGE .
+    docker build --build-arg VERSION=${RELEASE} -t $IMAGE .
     docker tag ${IMAGE}:latest ${IMAGE}:${RELEASE}
 
     echo "Pushing Docker Image ..."
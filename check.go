@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/check"
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+// stringsFlag is a flag which can be repeated, or set to a comma separated list.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
+
+// runCheck runs the check subcommand: it collects every configured cluster once, the
+// same way the metrics are collected, evaluates the thresholds set by args, and prints
+// the result as a Nagios plugin. It returns the plugin's exit status.
+func runCheck(args []string) int {
+	th := check.DefaultThresholds
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	loader := loaderFlags(flags)
+	timeout := flags.Duration("timeout", 10*time.Second, "time allowed for the collection")
+	flags.IntVar(&th.WarningFailedTasks, "warning-failed-tasks", th.WarningFailedTasks, "warn if more tasks have failed, -1 to disable")
+	flags.IntVar(&th.CriticalFailedTasks, "critical-failed-tasks", th.CriticalFailedTasks, "critical if more tasks have failed, -1 to disable")
+	flags.IntVar(&th.WarningFailedConnectors, "warning-failed-connectors", th.WarningFailedConnectors, "warn if more connectors have failed, -1 to disable")
+	flags.IntVar(&th.CriticalFailedConnectors, "critical-failed-connectors", th.CriticalFailedConnectors, "critical if more connectors have failed, -1 to disable")
+	flags.Var((*stringsFlag)(&th.Required), "require", "connector which must be running with all its tasks, can be repeated")
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			fmt.Println("Usage: kafka-connect-exporter check [flags]")
+			flags.SetOutput(os.Stdout)
+			flags.PrintDefaults()
+			return int(check.Unknown)
+		}
+		fmt.Printf("KAFKA CONNECT %s - %s\n", check.Unknown, err)
+		return int(check.Unknown)
+	}
+
+	res, err := collectCheck(loader, *timeout, th)
+	if err != nil {
+		fmt.Printf("KAFKA CONNECT %s - %s\n", check.Unknown, err)
+		return int(check.Unknown)
+	}
+	fmt.Println(res)
+	return int(res.Status)
+}
+
+// collectCheck collects the clusters configured by loader, and evaluates their snapshots
+// against th.
+func collectCheck(loader *config.Loader, timeout time.Duration, th check.Thresholds) (check.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	clusters, err := collect(ctx, loader)
+	if err != nil {
+		return check.Result{}, err
+	}
+	return check.Evaluate(clusters, th), nil
+}
+
+// collect updates the metrics of every cluster configured by loader once, and returns
+// their snapshots. Clusters collected partially by the time
+// ctx is done are returned without an error, with a truncated snapshot.
+func collect(ctx context.Context, loader *config.Loader) ([]check.Cluster, error) {
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := cfg.MetricsOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]*prometheus.Metrics, len(cfg.Clusters()))
+	for i, c := range cfg.Clusters() {
+		if metrics[i], err = newMetrics(cfg, c, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	clusters := make([]check.Cluster, len(metrics))
+	for i, m := range metrics {
+		clusters[i].Name = cfg.Clusters()[i].Name
+		wg.Add(1)
+		go func(c *check.Cluster, m *prometheus.Metrics) {
+			defer wg.Done()
+			c.Err = m.Update(ctx)
+			c.Snapshot = m.Snapshot()
+			if c.Snapshot.Truncated {
+				c.Err = nil
+			}
+		}(&clusters[i], m)
+	}
+	wg.Wait()
+	return clusters, nil
+}
@@ -0,0 +1,206 @@
+// Package check evaluates the state of kafka connect clusters against thresholds, with
+// the result reported in the format of a Nagios plugin: an exit status, and a single line
+// of output with performance data.
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+// Status is the outcome of a check, which is also the exit status of the plugin.
+type Status int
+
+// Nagios plugin statuses, in increasing order of severity, except for Unknown.
+const (
+	OK       Status = 0
+	Warning  Status = 1
+	Critical Status = 2
+	Unknown  Status = 3
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// worse reports whether s is more severe than other. Unknown is less severe than Critical,
+// and more than Warning.
+func (s Status) worse(other Status) bool {
+	order := map[Status]int{OK: 0, Warning: 1, Unknown: 2, Critical: 3}
+	return order[s] > order[other]
+}
+
+// Thresholds are the limits a check alerts on. Negative limits are disabled.
+type Thresholds struct {
+	// WarningFailedTasks and CriticalFailedTasks are the number of failed tasks over which
+	// the check is a warning, or critical.
+	WarningFailedTasks  int
+	CriticalFailedTasks int
+
+	// WarningFailedConnectors and CriticalFailedConnectors are the number of failed
+	// connectors over which the check is a warning, or critical.
+	WarningFailedConnectors  int
+	CriticalFailedConnectors int
+
+	// Required lists connectors which must exist, and be running along with every one of
+	// their tasks, for the check not to be critical.
+	Required []string
+}
+
+// DefaultThresholds are critical on any failed connector or task.
+var DefaultThresholds = Thresholds{
+	WarningFailedTasks:       -1,
+	CriticalFailedTasks:      0,
+	WarningFailedConnectors:  -1,
+	CriticalFailedConnectors: 0,
+}
+
+// Cluster is the outcome of the collection of a cluster.
+type Cluster struct {
+	Name     string
+	Snapshot prometheus.Snapshot
+
+	// Err is the error of the collection, if it failed.
+	Err error
+}
+
+// Perf is a performance data value. Negative thresholds are left out.
+type Perf struct {
+	Label    string
+	Value    int
+	Warning  int
+	Critical int
+}
+
+func (p Perf) String() string {
+	limit := func(n int) string {
+		if n < 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("'%s'=%d;%s;%s;0", p.Label, p.Value, limit(p.Warning), limit(p.Critical))
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status   Status
+	Messages []string
+	Perfdata []Perf
+}
+
+// String returns the result as the single line output of a Nagios plugin.
+func (r Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "KAFKA CONNECT %s - %s", r.Status, strings.Join(r.Messages, "; "))
+	if len(r.Perfdata) > 0 {
+		b.WriteString(" |")
+		for _, p := range r.Perfdata {
+			b.WriteString(" " + p.String())
+		}
+	}
+	return b.String()
+}
+
+// raise sets the status of the result to s, if it is worse, and adds the message.
+func (r *Result) raise(s Status, format string, args ...interface{}) {
+	if s.worse(r.Status) {
+		r.Status = s
+	}
+	r.Messages = append(r.Messages, fmt.Sprintf(format, args...))
+}
+
+// Evaluate checks the collected clusters against the thresholds. A cluster which could
+// not be collected, or was only partially collected, is unknown, as the check couldn't
+// run against it, and so is a required connector not found while any cluster is.
+func Evaluate(clusters []Cluster, th Thresholds) Result {
+	var res Result
+	var conns, tasks int
+	var failedConns, failedTasks []string
+	running := make(map[string]bool)
+	found := make(map[string]bool)
+	missing := Critical // the status of a required connector not found
+	for _, c := range clusters {
+		name := c.Name
+		if name == "" {
+			name = "cluster"
+		}
+		if c.Err != nil {
+			res.raise(Unknown, "%s can't be collected: %s", name, c.Err)
+			missing = Unknown
+			continue
+		}
+		if c.Snapshot.Truncated {
+			res.raise(Unknown, "%s was only partially collected", name)
+			missing = Unknown
+		}
+		prefix := ""
+		if len(clusters) > 1 {
+			prefix = name + ":"
+		}
+		for _, conn := range c.Snapshot.Connectors {
+			conns++
+			found[conn.Name] = true
+			ok := conn.State == connectapi.StateRunning
+			if conn.State == connectapi.StateFailed {
+				failedConns = append(failedConns, prefix+conn.Name)
+			}
+			for _, t := range conn.Tasks {
+				tasks++
+				ok = ok && t.State == connectapi.StateRunning
+				if t.State == connectapi.StateFailed {
+					failedTasks = append(failedTasks, prefix+conn.Name+"/"+strconv.Itoa(t.ID))
+				}
+			}
+			if _, seen := running[conn.Name]; !seen || !ok {
+				running[conn.Name] = ok
+			}
+		}
+	}
+
+	threshold := func(what string, failed []string, warning, critical int) {
+		n := len(failed)
+		sort.Strings(failed)
+		switch {
+		case critical >= 0 && n > critical:
+			res.raise(Critical, "%d failed %s (%s)", n, what, strings.Join(failed, ", "))
+		case warning >= 0 && n > warning:
+			res.raise(Warning, "%d failed %s (%s)", n, what, strings.Join(failed, ", "))
+		}
+	}
+	threshold("connectors", failedConns, th.WarningFailedConnectors, th.CriticalFailedConnectors)
+	threshold("tasks", failedTasks, th.WarningFailedTasks, th.CriticalFailedTasks)
+
+	for _, name := range th.Required {
+		switch {
+		case !found[name]:
+			res.raise(missing, "required connector %s not found", name)
+		case !running[name]:
+			res.raise(Critical, "required connector %s not running", name)
+		}
+	}
+
+	if len(res.Messages) == 0 {
+		res.Messages = []string{fmt.Sprintf("%d connectors and %d tasks, none failed", conns, tasks)}
+	}
+	res.Perfdata = []Perf{
+		{"connectors", conns, -1, -1},
+		{"failed_connectors", len(failedConns), th.WarningFailedConnectors, th.CriticalFailedConnectors},
+		{"tasks", tasks, -1, -1},
+		{"failed_tasks", len(failedTasks), th.WarningFailedTasks, th.CriticalFailedTasks},
+	}
+	return res
+}
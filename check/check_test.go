@@ -0,0 +1,130 @@
+package check_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/check"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+func connector(name, state string, taskStates ...string) prometheus.ConnectorSnapshot {
+	conn := prometheus.ConnectorSnapshot{Name: name, State: state}
+	for i, s := range taskStates {
+		conn.Tasks = append(conn.Tasks, prometheus.TaskSnapshot{ID: i, State: s})
+	}
+	return conn
+}
+
+func cluster(name string, conns ...prometheus.ConnectorSnapshot) check.Cluster {
+	return check.Cluster{Name: name, Snapshot: prometheus.Snapshot{Connectors: conns}}
+}
+
+type evaluateTestCase struct {
+	name       string
+	clusters   []check.Cluster
+	thresholds check.Thresholds
+	expect     string
+	status     check.Status
+}
+
+func TestEvaluate(t *testing.T) {
+	testCases := []evaluateTestCase{
+		{
+			name:       "ok",
+			clusters:   []check.Cluster{cluster("", connector("orders", "RUNNING", "RUNNING", "RUNNING"))},
+			thresholds: check.DefaultThresholds,
+			status:     check.OK,
+			expect:     "KAFKA CONNECT OK - 1 connectors and 2 tasks, none failed | 'connectors'=1;;;0 'failed_connectors'=0;;0;0 'tasks'=2;;;0 'failed_tasks'=0;;0;0",
+		},
+		{
+			name:       "failed task",
+			clusters:   []check.Cluster{cluster("", connector("orders", "RUNNING", "RUNNING", "FAILED"))},
+			thresholds: check.DefaultThresholds,
+			status:     check.Critical,
+			expect:     "KAFKA CONNECT CRITICAL - 1 failed tasks (orders/1) | 'connectors'=1;;;0 'failed_connectors'=0;;0;0 'tasks'=2;;;0 'failed_tasks'=1;;0;0",
+		},
+		{
+			name: "failed tasks under critical threshold",
+			clusters: []check.Cluster{
+				cluster("a", connector("orders", "RUNNING", "FAILED")),
+				cluster("b", connector("orders", "RUNNING", "RUNNING")),
+			},
+			thresholds: check.Thresholds{WarningFailedTasks: 0, CriticalFailedTasks: 2, WarningFailedConnectors: -1, CriticalFailedConnectors: -1},
+			status:     check.Warning,
+			expect:     "KAFKA CONNECT WARNING - 1 failed tasks (a:orders/0) | 'connectors'=2;;;0 'failed_connectors'=0;;;0 'tasks'=2;;;0 'failed_tasks'=1;0;2;0",
+		},
+		{
+			name:       "required connector paused",
+			clusters:   []check.Cluster{cluster("", connector("orders", "PAUSED", "PAUSED"))},
+			thresholds: check.Thresholds{WarningFailedTasks: -1, CriticalFailedTasks: -1, WarningFailedConnectors: -1, CriticalFailedConnectors: -1, Required: []string{"orders", "users"}},
+			status:     check.Critical,
+			expect:     "KAFKA CONNECT CRITICAL - required connector orders not running; required connector users not found | 'connectors'=1;;;0 'failed_connectors'=0;;;0 'tasks'=1;;;0 'failed_tasks'=0;;;0",
+		},
+		{
+			name: "collection failed",
+			clusters: []check.Cluster{
+				{Name: "a", Err: errors.New("connection refused")},
+				{Name: "b", Snapshot: prometheus.Snapshot{Truncated: true}},
+			},
+			thresholds: check.DefaultThresholds,
+			status:     check.Unknown,
+			expect:     "KAFKA CONNECT UNKNOWN - a can't be collected: connection refused; b was only partially collected | 'connectors'=0;;;0 'failed_connectors'=0;;0;0 'tasks'=0;;;0 'failed_tasks'=0;;0;0",
+		},
+		{
+			name: "collection failed with a failed task",
+			clusters: []check.Cluster{
+				{Name: "a", Err: errors.New("connection refused")},
+				cluster("b", connector("orders", "RUNNING", "FAILED")),
+			},
+			thresholds: check.DefaultThresholds,
+			status:     check.Critical,
+			expect:     "KAFKA CONNECT CRITICAL - a can't be collected: connection refused; 1 failed tasks (b:orders/0) | 'connectors'=1;;;0 'failed_connectors'=0;;0;0 'tasks'=1;;;0 'failed_tasks'=1;;0;0",
+		},
+		{
+			name:       "required connector in a cluster that failed",
+			clusters:   []check.Cluster{{Err: errors.New("connection refused")}},
+			thresholds: check.Thresholds{WarningFailedTasks: -1, CriticalFailedTasks: -1, WarningFailedConnectors: -1, CriticalFailedConnectors: -1, Required: []string{"orders-sink"}},
+			status:     check.Unknown,
+			expect:     "KAFKA CONNECT UNKNOWN - cluster can't be collected: connection refused; required connector orders-sink not found | 'connectors'=0;;;0 'failed_connectors'=0;;;0 'tasks'=0;;;0 'failed_tasks'=0;;;0",
+		},
+		{
+			name: "required connector in a partially collected cluster",
+			clusters: []check.Cluster{{Snapshot: prometheus.Snapshot{
+				Truncated:  true,
+				Connectors: []prometheus.ConnectorSnapshot{connector("orders", "PAUSED", "PAUSED")},
+			}}},
+			thresholds: check.Thresholds{WarningFailedTasks: -1, CriticalFailedTasks: -1, WarningFailedConnectors: -1, CriticalFailedConnectors: -1, Required: []string{"orders", "users"}},
+			status:     check.Critical,
+			expect:     "KAFKA CONNECT CRITICAL - cluster was only partially collected; required connector orders not running; required connector users not found | 'connectors'=1;;;0 'failed_connectors'=0;;;0 'tasks'=1;;;0 'failed_tasks'=0;;;0",
+		},
+		{
+			name:       "required connector not found in a partially collected cluster",
+			clusters:   []check.Cluster{{Snapshot: prometheus.Snapshot{Truncated: true, Connectors: []prometheus.ConnectorSnapshot{connector("orders", "RUNNING", "RUNNING")}}}},
+			thresholds: check.Thresholds{WarningFailedTasks: -1, CriticalFailedTasks: -1, WarningFailedConnectors: -1, CriticalFailedConnectors: -1, Required: []string{"orders", "users"}},
+			status:     check.Unknown,
+			expect:     "KAFKA CONNECT UNKNOWN - cluster was only partially collected; required connector users not found | 'connectors'=1;;;0 'failed_connectors'=0;;;0 'tasks'=1;;;0 'failed_tasks'=0;;;0",
+		},
+		{
+			name:       "partially collected",
+			clusters:   []check.Cluster{{Snapshot: prometheus.Snapshot{Truncated: true}}},
+			thresholds: check.DefaultThresholds,
+			status:     check.Unknown,
+			expect:     "KAFKA CONNECT UNKNOWN - cluster was only partially collected | 'connectors'=0;;;0 'failed_connectors'=0;;0;0 'tasks'=0;;;0 'failed_tasks'=0;;0;0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc evaluateTestCase) assert(t *testing.T) {
+	res := check.Evaluate(tc.clusters, tc.thresholds)
+	if res.Status != tc.status {
+		t.Errorf("expected status %s, got %s", tc.status, res.Status)
+	}
+	if got := res.String(); got != tc.expect {
+		t.Errorf("unexpected output:\nexpected: %s\ngot:      %s", tc.expect, got)
+	}
+}
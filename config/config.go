@@ -0,0 +1,713 @@
+// Package config provides loading and validation of the exporter's configuration.
+//
+// Configuration is assembled from the following sources, with later sources taking
+// precedence over earlier ones: built-in defaults, consul (if configured), the local YAML
+// file, environment variables, and command line flags. See config.yaml.example for the
+// file format.
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/logging"
+	"github.com/autotraderuk/kafka-connect-exporter/otlp"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/remotewrite"
+	"github.com/autotraderuk/kafka-connect-exporter/transport"
+	"github.com/caarlos0/env"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultPollInterval is the poll interval, in seconds, used when none is configured.
+	DefaultPollInterval = 10
+
+	// DefaultConfigLabelMaxLength is the default cap on the length of label values taken
+	// from connector configs.
+	DefaultConfigLabelMaxLength = 64
+
+	// DefaultSnapshotMaxAge is the default time, in seconds, the last successful snapshot
+	// is served for while the API can't be reached.
+	DefaultSnapshotMaxAge = 300
+
+	// DefaultRequestTimeout is the default time, in seconds, allowed for each API call.
+	DefaultRequestTimeout = 10
+
+	// DefaultRetries is the default number of times a failed API call is retried.
+	DefaultRetries = 3
+
+	// DefaultRetryMinBackoff and DefaultRetryMaxBackoff are the default bounds, in
+	// milliseconds, of the time between two attempts of an API call.
+	DefaultRetryMinBackoff = 200
+	DefaultRetryMaxBackoff = 5000
+
+	// DefaultScrapeTimeoutMargin is the default time, in milliseconds, subtracted from the
+	// scrape timeout sent by prometheus.
+	DefaultScrapeTimeoutMargin = 500
+
+	// DefaultReadyIntervals is the default number of poll intervals a cluster may go
+	// without a successful collection before the exporter is no longer ready.
+	DefaultReadyIntervals = 3
+
+	// DefaultPort is the port the exporter listens on when none is configured.
+	DefaultPort = 9400
+
+	// DefaultSocketMode is the default file mode of the unix sockets the exporter
+	// listens on.
+	DefaultSocketMode = "0660"
+
+	redacted = "REDACTED"
+)
+
+// Config is the complete exporter configuration.
+type Config struct {
+	Connect     Connect     `yaml:"connect"`
+	Logging     Logging     `yaml:"logging"`
+	Metadata    Metadata    `yaml:"metadata,omitempty"`
+	Config      Sources     `yaml:"config"`
+	Prometheus  Prometheus  `yaml:"prometheus"`
+	Web         Web         `yaml:"web,omitempty"`
+	Pushgateway Pushgateway `yaml:"pushgateway,omitempty"`
+	OTLP        OTLP        `yaml:"otlp,omitempty"`
+	StatsD      StatsD      `yaml:"statsd"`
+	RemoteWrite RemoteWrite `yaml:"remote-write,omitempty"`
+}
+
+// Connect configures the kafka connect cluster(s) to monitor.
+type Connect struct {
+	// Host is the REST API host of a single kafka connect cluster.
+	Host string `yaml:"host" env:"KAFKA_CONNECT_HOST"`
+
+	// PollInterval is the interval, in seconds, at which the API will be polled.
+	PollInterval int `yaml:"poll-interval" env:"KAFKA_CONNECT_POLL_INTERVAL"`
+
+	// Clusters lists several named kafka connect clusters to monitor. It is an
+	// alternative to Host.
+	Clusters []Cluster `yaml:"clusters,omitempty"`
+
+	// Include, if not empty, limits the monitored connectors to those with a name matching
+	// at least one of the regular expressions.
+	Include []string `yaml:"include,omitempty"`
+
+	// Exclude lists regular expressions matching the names of connectors which will not
+	// be monitored.
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// NamePattern is a regular expression matched against connector names. The value of
+	// each named capture group is attached to the connector's metrics as a label.
+	NamePattern string `yaml:"name-pattern,omitempty"`
+
+	// ConfigLabels lists connector config keys whose values are attached to the
+	// connector's metrics as labels. Characters not allowed in label names are replaced
+	// by underscores.
+	ConfigLabels []string `yaml:"config-labels,omitempty"`
+
+	// ConfigLabelMaxLength caps the length of label values taken from connector configs.
+	// Zero means no limit.
+	ConfigLabelMaxLength int `yaml:"config-label-max-length"`
+
+	// MaxConnectors caps the number of connectors of each cluster with their own series.
+	// Further connectors are aggregated into a single "__other__" connector. Zero means no
+	// limit.
+	MaxConnectors int `yaml:"max-connectors,omitempty" env:"KAFKA_CONNECT_MAX_CONNECTORS"`
+
+	// SnapshotMaxAge is how long, in seconds, the last successful snapshot of a cluster is
+	// served while the API can't be reached.
+	SnapshotMaxAge int `yaml:"snapshot-max-age" env:"KAFKA_CONNECT_SNAPSHOT_MAX_AGE"`
+
+	// RequestTimeout is the time, in seconds, allowed for each call to the API.
+	RequestTimeout int `yaml:"request-timeout" env:"KAFKA_CONNECT_REQUEST_TIMEOUT"`
+
+	// Retries is the number of times failed idempotent calls to the API are retried.
+	Retries int `yaml:"retries" env:"KAFKA_CONNECT_RETRIES"`
+
+	// RetryMinBackoff and RetryMaxBackoff bound the time, in milliseconds, between two
+	// attempts of a call, which doubles after each attempt.
+	RetryMinBackoff int `yaml:"retry-min-backoff" env:"KAFKA_CONNECT_RETRY_MIN_BACKOFF"`
+	RetryMaxBackoff int `yaml:"retry-max-backoff" env:"KAFKA_CONNECT_RETRY_MAX_BACKOFF"`
+}
+
+// Transport returns the transport used for calls to the API, which retries failed calls.
+func (c Connect) Transport() *transport.Retry {
+	retries := c.Retries
+	if retries == 0 {
+		retries = -1
+	}
+	return &transport.Retry{
+		MaxRetries: retries,
+		MinBackoff: time.Duration(c.RetryMinBackoff) * time.Millisecond,
+		MaxBackoff: time.Duration(c.RetryMaxBackoff) * time.Millisecond,
+		Timeout:    time.Duration(c.RequestTimeout) * time.Second,
+	}
+}
+
+// reservedLabels are the label names used by the exporter's own metrics.
+var reservedLabels = map[string]bool{
+	"cluster":   true,
+	"connector": true,
+	"state":     true,
+	"worker":    true,
+}
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Filters returns the compiled include and exclude patterns.
+func (c Connect) Filters() (include, exclude []*regexp.Regexp, err error) {
+	if include, err = compileAll(c.Include); err != nil {
+		return nil, nil, errors.Wrap(err, "connect.include")
+	}
+	if exclude, err = compileAll(c.Exclude); err != nil {
+		return nil, nil, errors.Wrap(err, "connect.exclude")
+	}
+	return include, exclude, nil
+}
+
+// NameRegexp returns the compiled name pattern, or nil if none is set.
+func (c Connect) NameRegexp() (*regexp.Regexp, error) {
+	if c.NamePattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(c.NamePattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect.name-pattern")
+	}
+	for _, name := range re.SubexpNames() {
+		switch {
+		case name == "":
+		case !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__"):
+			return nil, errors.Errorf("connect.name-pattern: %q is not a valid label name", name)
+		case reservedLabels[name]:
+			return nil, errors.Errorf("connect.name-pattern: label %q is reserved", name)
+		}
+	}
+	return re, nil
+}
+
+// validateLabels checks that the labels derived from connector names and configs are
+// valid, and don't collide with each other or with the exporter's own labels.
+func (c Connect) validateLabels() error {
+	re, err := c.NameRegexp()
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	if re != nil {
+		for _, name := range re.SubexpNames() {
+			seen[name] = true
+		}
+	}
+	for _, key := range c.ConfigLabels {
+		name := prometheus.SanitizeLabelName(key)
+		switch {
+		case reservedLabels[name]:
+			return errors.Errorf("connect.config-labels: label %q is reserved", name)
+		case strings.HasPrefix(name, "__"):
+			return errors.Errorf("connect.config-labels: %q is not a valid label name", name)
+		case seen[name]:
+			return errors.Errorf("connect.config-labels: label %q is used more than once", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Cluster is a single named kafka connect cluster.
+type Cluster struct {
+	// Name identifies the cluster, and is attached to its metrics as the "cluster" label.
+	// It is empty for a cluster configured via connect.host.
+	Name string `yaml:"name"`
+
+	// Host is the REST API host of the cluster.
+	Host string `yaml:"host"`
+}
+
+// Logging configures the log output, and the optional error reporters.
+type Logging struct {
+	// Level is the minimum level of logged messages: debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+
+	// Format is the log format: logfmt or json.
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+
+	HTTP       HTTPReporter `yaml:"http"`
+	Logentries Logentries   `yaml:"logentries"`
+	Rollbar    Rollbar      `yaml:"rollbar"`
+}
+
+// HTTPReporter configures reporting of errors to a generic HTTP endpoint, which receives
+// each error as a JSON object.
+type HTTPReporter struct {
+	URL string `yaml:"url" env:"ERROR_REPORTER_URL"`
+
+	// Token is an optional bearer token.
+	Token string `yaml:"token" env:"ERROR_REPORTER_TOKEN"`
+}
+
+// Logentries configures reporting to logentries.
+type Logentries struct {
+	Token string `yaml:"token" env:"LOGENTRIES_TOKEN"`
+}
+
+// Rollbar configures reporting to rollbar.
+type Rollbar struct {
+	Token string `yaml:"token" env:"ROLLBAR_TOKEN"`
+	Env   string `yaml:"env" env:"ROLLBAR_ENV"`
+}
+
+// Metadata configures the catalog of connector metadata, such as owners and runbooks.
+type Metadata struct {
+	// File is the path of a YAML or CSV catalog file. It is watched for changes.
+	File string `yaml:"file,omitempty" env:"METADATA_FILE"`
+}
+
+// Sources configures alternative configuration locations.
+type Sources struct {
+	Consul Consul `yaml:"consul"`
+}
+
+// Consul configures a consul KV configuration source.
+type Consul struct {
+	// Host is the consul HTTP API host. The port defaults to 8500.
+	Host string `yaml:"host" env:"CONSUL_HOST"`
+
+	// Path is the KV key holding the YAML config document.
+	Path string `yaml:"path" env:"CONSUL_PATH"`
+
+	// Token is an optional ACL token used for consul requests.
+	Token string `yaml:"token" env:"CONSUL_TOKEN"`
+}
+
+// Prometheus configures the metrics endpoint, and the names and labels of the metrics.
+type Prometheus struct {
+	Port int `yaml:"port" env:"PORT"`
+
+	// Namespace and Subsystem prefix the names of the connector metrics.
+	Namespace string `yaml:"namespace" env:"PROMETHEUS_NAMESPACE"`
+	Subsystem string `yaml:"subsystem" env:"PROMETHEUS_SUBSYSTEM"`
+
+	// ConstLabels are attached to every metric served by the exporter.
+	ConstLabels map[string]string `yaml:"const-labels,omitempty"`
+
+	// LabelNames renames the exporter's labels, such as "connector", which are the keys
+	// of the map.
+	LabelNames map[string]string `yaml:"label-names,omitempty"`
+
+	// MaxSeries caps the number of connector series served, shared equally between the
+	// clusters, including the series of the "__other__" connector. Once it is reached,
+	// further connectors are aggregated into the "__other__" connector. Zero means no
+	// limit.
+	MaxSeries int `yaml:"max-series,omitempty" env:"PROMETHEUS_MAX_SERIES"`
+
+	// ScrapeTimeoutMargin is subtracted from the scrape timeout sent by prometheus, in
+	// milliseconds, to leave time to serve what was collected before prometheus gives up.
+	ScrapeTimeoutMargin int `yaml:"scrape-timeout-margin" env:"PROMETHEUS_SCRAPE_TIMEOUT_MARGIN"`
+
+	// ReadyIntervals is the number of poll intervals within which every cluster must have
+	// been collected successfully for /-/ready to report the exporter as ready.
+	ReadyIntervals int `yaml:"ready-intervals" env:"PROMETHEUS_READY_INTERVALS"`
+}
+
+// Default returns a config populated with default values only.
+func Default() *Config {
+	return &Config{
+		Connect: Connect{
+			PollInterval:         DefaultPollInterval,
+			ConfigLabelMaxLength: DefaultConfigLabelMaxLength,
+			SnapshotMaxAge:       DefaultSnapshotMaxAge,
+			RequestTimeout:       DefaultRequestTimeout,
+			Retries:              DefaultRetries,
+			RetryMinBackoff:      DefaultRetryMinBackoff,
+			RetryMaxBackoff:      DefaultRetryMaxBackoff,
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: string(logging.LogfmtFormat),
+		},
+		Prometheus: Prometheus{
+			Port:                DefaultPort,
+			Namespace:           prometheus.DefaultNamespace,
+			Subsystem:           prometheus.DefaultSubsystem,
+			ScrapeTimeoutMargin: DefaultScrapeTimeoutMargin,
+			ReadyIntervals:      DefaultReadyIntervals,
+		},
+		Web: Web{
+			SocketMode: DefaultSocketMode,
+		},
+		Pushgateway: Pushgateway{
+			Job:     DefaultPushgatewayJob,
+			Retries: DefaultRetries,
+			Timeout: DefaultRequestTimeout,
+		},
+		OTLP: OTLP{
+			Protocol: string(otlp.GRPC),
+			Timeout:  DefaultRequestTimeout,
+		},
+		StatsD: StatsD{
+			Tags: true,
+		},
+		RemoteWrite: RemoteWrite{
+			Retries:       remotewrite.DefaultMaxRetries,
+			Timeout:       DefaultRequestTimeout,
+			QueueCapacity: remotewrite.DefaultCapacity,
+		},
+	}
+}
+
+// Load returns the config built from defaults, any remote source it points to, the YAML
+// file at path, and environment variables, in that order of precedence. If path is
+// empty, no file is read. The resulting config is validated before it is returned.
+func Load(path string) (*Config, error) {
+	l := &Loader{Path: path}
+	return l.Load(context.Background())
+}
+
+// build returns the config built from defaults, the given YAML documents, environment
+// variables and the flags set, in that order of precedence. Empty documents are skipped. The result is not
+// validated.
+func build(flags *Flags, docs ...document) (*Config, error) {
+	cfg := Default()
+	for _, doc := range docs {
+		if len(doc.data) == 0 {
+			continue
+		}
+		if err := cfg.merge(doc.data); err != nil {
+			return nil, errors.Wrapf(err, "parsing config from %s", doc.source)
+		}
+	}
+	if err := cfg.parseEnv(); err != nil {
+		return nil, errors.Wrap(err, "parsing environment variables")
+	}
+	flags.apply(cfg)
+	cfg.normalize()
+	return cfg, nil
+}
+
+// document is a YAML config document, along with a description of where it came from.
+type document struct {
+	source fmt.Stringer
+	data   []byte
+}
+
+// merge decodes the YAML document in data over the config. Unknown keys are rejected, so
+// that typos are reported rather than silently ignored.
+func (c *Config) merge(data []byte) error {
+	return yaml.UnmarshalStrict(data, c)
+}
+
+// parseEnv overlays any environment variables that are set onto the config.
+func (c *Config) parseEnv() error {
+	for _, v := range []interface{}{
+		&c.Connect,
+		&c.Logging,
+		&c.Logging.HTTP,
+		&c.Logging.Logentries,
+		&c.Logging.Rollbar,
+		&c.Metadata,
+		&c.Config.Consul,
+		&c.Prometheus,
+		&c.Web,
+		&c.Pushgateway,
+		&c.OTLP,
+		&c.StatsD,
+		&c.RemoteWrite,
+	} {
+		if err := env.Parse(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize fills in the http scheme on hosts that were given as host:port only, as in
+// config.yaml.example.
+func (c *Config) normalize() {
+	c.Connect.Host = normalizeHost(c.Connect.Host)
+	for i := range c.Connect.Clusters {
+		c.Connect.Clusters[i].Host = normalizeHost(c.Connect.Clusters[i].Host)
+	}
+}
+
+func normalizeHost(host string) string {
+	if host == "" || strings.Contains(host, "://") {
+		return host
+	}
+	return "http://" + host
+}
+
+// ListenAddresses returns the addresses the exporter listens on, which default to the
+// prometheus port on every interface.
+func (c *Config) ListenAddresses() []string {
+	if len(c.Web.ListenAddress) > 0 {
+		return c.Web.ListenAddress
+	}
+	return []string{fmt.Sprintf(":%d", c.Prometheus.Port)}
+}
+
+// Clusters returns the kafka connect clusters to monitor.
+func (c *Config) Clusters() []Cluster {
+	if c.Connect.Host != "" {
+		return []Cluster{{Host: c.Connect.Host}}
+	}
+	return c.Connect.Clusters
+}
+
+// ValidationError lists every problem found while validating a config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+// Validate checks the config for missing or invalid values. If any are found, a
+// ValidationError describing all of them is returned.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.Connect.Host != "" && len(c.Connect.Clusters) > 0:
+		fail("connect.host and connect.clusters are mutually exclusive")
+	case c.Connect.Host == "" && len(c.Connect.Clusters) == 0:
+		fail("connect.host must be set")
+	case c.Connect.Host != "":
+		if err := validateHost(c.Connect.Host); err != nil {
+			fail("connect.host: %s", err)
+		}
+	}
+	names := make(map[string]bool)
+	for i, cl := range c.Connect.Clusters {
+		switch {
+		case cl.Name == "":
+			fail("connect.clusters[%d].name must be set", i)
+		case names[cl.Name]:
+			fail("connect.clusters[%d].name %q is not unique", i, cl.Name)
+		}
+		names[cl.Name] = true
+		if cl.Host == "" {
+			fail("connect.clusters[%d].host must be set", i)
+		} else if err := validateHost(cl.Host); err != nil {
+			fail("connect.clusters[%d].host: %s", i, err)
+		}
+	}
+	if c.Connect.PollInterval <= 0 {
+		fail("connect.poll-interval must be positive, got %d", c.Connect.PollInterval)
+	}
+	if _, _, err := c.Connect.Filters(); err != nil {
+		fail("%s", err)
+	}
+	if err := c.Connect.validateLabels(); err != nil {
+		fail("%s", err)
+	}
+	if c.Connect.ConfigLabelMaxLength < 0 {
+		fail("connect.config-label-max-length must not be negative, got %d", c.Connect.ConfigLabelMaxLength)
+	}
+	if c.Connect.SnapshotMaxAge < 0 {
+		fail("connect.snapshot-max-age must not be negative, got %d", c.Connect.SnapshotMaxAge)
+	}
+	if c.Connect.RequestTimeout <= 0 {
+		fail("connect.request-timeout must be positive, got %d", c.Connect.RequestTimeout)
+	}
+	if c.Connect.Retries < 0 {
+		fail("connect.retries must not be negative, got %d", c.Connect.Retries)
+	}
+	if c.Connect.RetryMinBackoff <= 0 || c.Connect.RetryMaxBackoff < c.Connect.RetryMinBackoff {
+		fail("connect.retry-min-backoff must be positive, and at most connect.retry-max-backoff")
+	}
+	if c.Connect.MaxConnectors < 0 {
+		fail("connect.max-connectors must not be negative, got %d", c.Connect.MaxConnectors)
+	}
+
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		fail("logging.level: %s", err)
+	}
+	if _, err := logging.ParseFormat(c.Logging.Format); err != nil {
+		fail("logging.format: %s", err)
+	}
+	if c.Logging.HTTP.URL == "" && c.Logging.HTTP.Token != "" {
+		fail("logging.http.url must be set when logging.http.token is set")
+	} else if c.Logging.HTTP.URL != "" {
+		if err := validateHost(c.Logging.HTTP.URL); err != nil {
+			fail("logging.http.url: %s", err)
+		}
+	}
+	if c.Logging.Rollbar.Token == "" && c.Logging.Rollbar.Env != "" {
+		fail("logging.rollbar.token must be set when logging.rollbar.env is set")
+	}
+
+	consul := c.Config.Consul
+	if (consul.Host == "") != (consul.Path == "") {
+		fail("config.consul.host and config.consul.path must be set together")
+	}
+
+	if c.Prometheus.Port <= 0 || c.Prometheus.Port > 65535 {
+		fail("prometheus.port must be between 1 and 65535, got %d", c.Prometheus.Port)
+	}
+	for _, addr := range c.Web.ListenAddress {
+		if _, _, err := ParseListenAddress(addr); err != nil {
+			fail("web.listen-address: %s", err)
+		}
+	}
+	if _, err := c.Web.FileMode(); err != nil {
+		fail("web.socket-mode: %s", err)
+	}
+	c.Pushgateway.validate(c.clusterLabel(), fail)
+	c.OTLP.validate(fail)
+	c.StatsD.validate(fail)
+	c.RemoteWrite.validate(fail)
+	if c.Prometheus.ScrapeTimeoutMargin < 0 {
+		fail("prometheus.scrape-timeout-margin must not be negative, got %d", c.Prometheus.ScrapeTimeoutMargin)
+	}
+	if c.Prometheus.ReadyIntervals <= 0 {
+		fail("prometheus.ready-intervals must be positive, got %d", c.Prometheus.ReadyIntervals)
+	}
+	if c.Prometheus.MaxSeries < 0 {
+		fail("prometheus.max-series must not be negative, got %d", c.Prometheus.MaxSeries)
+	}
+	if opts, err := c.MetricsOpts(); err == nil {
+		for _, cl := range c.Clusters() {
+			opts.Cluster = cl.Name
+			if err := opts.Validate(); err != nil {
+				fail("prometheus: %s", err)
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateHost(host string) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("%q must be an http or https URL", host)
+	}
+	if u.Host == "" {
+		return errors.Errorf("%q has no host", host)
+	}
+	return nil
+}
+
+// MetricsOpts returns the options shared by the metrics of every cluster.
+func (c *Config) MetricsOpts() (prometheus.Opts, error) {
+	include, exclude, err := c.Connect.Filters()
+	if err != nil {
+		return prometheus.Opts{}, err
+	}
+	namePattern, err := c.Connect.NameRegexp()
+	if err != nil {
+		return prometheus.Opts{}, err
+	}
+	maxSeries := c.Prometheus.MaxSeries
+	if clusters := len(c.Clusters()); maxSeries > 0 && clusters > 1 {
+		maxSeries /= clusters
+		if maxSeries == 0 {
+			maxSeries = 1
+		}
+	}
+	return prometheus.Opts{
+		Namespace:   c.Prometheus.Namespace,
+		Subsystem:   c.Prometheus.Subsystem,
+		ConstLabels: c.Prometheus.ConstLabels,
+		LabelNames:  c.Prometheus.LabelNames,
+
+		PollInterval:   time.Duration(c.Connect.PollInterval) * time.Second,
+		MaxSnapshotAge: time.Duration(c.Connect.SnapshotMaxAge) * time.Second,
+		Include:        include,
+		Exclude:        exclude,
+		NamePattern:    namePattern,
+
+		ConfigLabels:        c.Connect.ConfigLabels,
+		MaxLabelValueLength: c.Connect.ConfigLabelMaxLength,
+
+		MaxConnectors: c.Connect.MaxConnectors,
+		MaxSeries:     maxSeries,
+	}, nil
+}
+
+// Redacted returns a copy of the config with secrets, such as tokens and passwords in
+// host URLs, masked out.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	cp.Connect.Host = redactURL(c.Connect.Host)
+	cp.Connect.Clusters = make([]Cluster, len(c.Connect.Clusters))
+	for i, cl := range c.Connect.Clusters {
+		cl.Host = redactURL(cl.Host)
+		cp.Connect.Clusters[i] = cl
+	}
+	cp.Logging.HTTP.URL = redactURL(c.Logging.HTTP.URL)
+	cp.Logging.HTTP.Token = redact(c.Logging.HTTP.Token)
+	cp.Logging.Logentries.Token = redact(c.Logging.Logentries.Token)
+	cp.Logging.Rollbar.Token = redact(c.Logging.Rollbar.Token)
+	cp.Config.Consul.Host = redactURL(c.Config.Consul.Host)
+	cp.Config.Consul.Token = redact(c.Config.Consul.Token)
+	cp.Pushgateway.URL = redactURL(c.Pushgateway.URL)
+	cp.Pushgateway.Password = redact(c.Pushgateway.Password)
+	cp.Pushgateway.BearerToken = redact(c.Pushgateway.BearerToken)
+	cp.RemoteWrite.URL = redactURL(c.RemoteWrite.URL)
+	cp.RemoteWrite.Password = redact(c.RemoteWrite.Password)
+	cp.RemoteWrite.BearerToken = redact(c.RemoteWrite.BearerToken)
+	cp.OTLP.Endpoint = redactURL(c.OTLP.Endpoint)
+	if len(c.OTLP.Headers) > 0 {
+		cp.OTLP.Headers = make(map[string]string, len(c.OTLP.Headers))
+		for k, v := range c.OTLP.Headers {
+			cp.OTLP.Headers[k] = redact(v)
+		}
+	}
+	return &cp
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// ServeHTTP writes the config, with secrets redacted, as YAML.
+func (c *Config) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(data)
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultConsulWaitTime is the maximum duration of a single consul blocking query.
+	DefaultConsulWaitTime = 5 * time.Minute
+
+	defaultConsulPort = "8500"
+)
+
+// ConsulSource is a Watcher reading a YAML config document from a consul KV key.
+type ConsulSource struct {
+	// HTTPClient is used for consul requests. By default http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// WaitTime is the maximum duration of a single blocking query. It defaults to
+	// DefaultConsulWaitTime.
+	WaitTime time.Duration
+
+	host  *url.URL
+	key   string
+	token string
+
+	mu    sync.Mutex
+	index uint64
+}
+
+// NewConsulSource returns a source reading the key at cfg.Path from the consul agent at
+// cfg.Host. If the host has no scheme, http is assumed, and if it has no port, the consul
+// default of 8500 is used.
+func NewConsulSource(cfg Consul) *ConsulSource {
+	host := cfg.Host
+	if !strings.Contains(host, "://") {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, defaultConsulPort)
+		}
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		u = &url.URL{Scheme: "http", Host: cfg.Host}
+	}
+	return &ConsulSource{
+		host:  u,
+		key:   strings.TrimPrefix(cfg.Path, "/"),
+		token: cfg.Token,
+	}
+}
+
+func (s *ConsulSource) String() string {
+	return "consul key " + s.key
+}
+
+// Read returns the value of the key. An empty document is returned if the key does not
+// exist.
+func (s *ConsulSource) Read(ctx context.Context) ([]byte, error) {
+	data, index, err := s.get(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.setIndex(index)
+	return data, nil
+}
+
+// Watch uses consul blocking queries to wait until the key's value differs from the one
+// last returned by Read or Watch, and returns the new value.
+func (s *ConsulSource) Watch(ctx context.Context) ([]byte, error) {
+	for {
+		last := s.getIndex()
+		data, index, err := s.get(ctx, last)
+		if err != nil {
+			return nil, err
+		}
+		s.setIndex(index)
+		// the index only changes when the key is modified, but consul also returns when
+		// the wait time elapses. An index going backwards means consul's state was reset.
+		if index != last {
+			return data, nil
+		}
+	}
+}
+
+func (s *ConsulSource) getIndex() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index
+}
+
+func (s *ConsulSource) setIndex(index uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = index
+}
+
+// get fetches the raw value of the key, blocking until its modify index exceeds the given
+// index, if it is non-zero. It returns the value along with its current index.
+func (s *ConsulSource) get(ctx context.Context, index uint64) ([]byte, uint64, error) {
+	u := s.host.ResolveReference(&url.URL{Path: "/v1/kv/" + s.key})
+	q := url.Values{"raw": {""}}
+	if index > 0 {
+		wait := s.WaitTime
+		if wait == 0 {
+			wait = DefaultConsulWaitTime
+		}
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", wait.String())
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNotFound && (res.StatusCode < 200 || res.StatusCode >= 300) {
+		return nil, 0, errors.Errorf("status code %d from consul", res.StatusCode)
+	}
+	newIndex, err := strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "parsing X-Consul-Index header")
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, newIndex, nil
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, newIndex, nil
+}
@@ -0,0 +1,239 @@
+package config_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+)
+
+func TestConsulSourceRead(t *testing.T) {
+	kv := newMockConsul("configs/exporter.yaml", "connect:\n  host: http://example.com:8083\n")
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	src := config.NewConsulSource(config.Consul{Host: srv.URL, Path: "/configs/exporter.yaml", Token: "secret"})
+	data, err := src.Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "connect:\n  host: http://example.com:8083\n" {
+		t.Errorf("unexpected value %q", data)
+	}
+	if kv.lastToken() != "secret" {
+		t.Errorf("expected token to be sent, got %q", kv.lastToken())
+	}
+}
+
+func TestConsulSourceReadMissingKey(t *testing.T) {
+	srv := httptest.NewServer(newMockConsul("configs/exporter.yaml", "connect: {}"))
+	defer srv.Close()
+
+	src := config.NewConsulSource(config.Consul{Host: srv.URL, Path: "/configs/other.yaml"})
+	data, err := src.Read(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("expected empty document, got %q", data)
+	}
+}
+
+func TestConsulSourceWatch(t *testing.T) {
+	kv := newMockConsul("configs/exporter.yaml", "first")
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	src := config.NewConsulSource(config.Consul{Host: srv.URL, Path: "/configs/exporter.yaml"})
+	src.WaitTime = 50 * time.Millisecond
+	if _, err := src.Read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		// let the watch time out at least once before changing the value
+		time.Sleep(120 * time.Millisecond)
+		kv.set("second")
+	}()
+
+	data, err := src.Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("unexpected value %q", data)
+	}
+}
+
+func TestLoaderConsulPrecedence(t *testing.T) {
+	kv := newMockConsul("configs/exporter.yaml", `
+connect:
+  host: http://consul.example.com:8083
+  poll-interval: 60
+prometheus:
+  port: 9401
+`)
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	path := writeTempFile(t, `
+connect:
+  poll-interval: 30
+config:
+  consul:
+    host: `+srv.URL+`
+    path: /configs/exporter.yaml
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Setenv("PORT", "9402")
+	defer os.Unsetenv("PORT")
+
+	l := &config.Loader{Path: path}
+	cfg, err := l.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Connect.Host != "http://consul.example.com:8083" {
+		t.Errorf("expected host from consul, got %q", cfg.Connect.Host)
+	}
+	if cfg.Connect.PollInterval != 30 {
+		t.Errorf("expected poll interval from file, got %d", cfg.Connect.PollInterval)
+	}
+	if cfg.Prometheus.Port != 9402 {
+		t.Errorf("expected port from environment, got %d", cfg.Prometheus.Port)
+	}
+}
+
+func TestLoaderWatch(t *testing.T) {
+	kv := newMockConsul("configs/exporter.yaml", "connect:\n  host: http://a.example.com:8083\n")
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	path := writeTempFile(t, "config:\n  consul:\n    host: "+srv.URL+"\n    path: configs/exporter.yaml\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l := &config.Loader{Path: path}
+	if _, err := l.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	configs := make(chan *config.Config)
+	errs := make(chan error)
+	go l.Watch(ctx, func(cfg *config.Config, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		configs <- cfg
+	})
+
+	kv.set("connect:\n  host: http://b.example.com:8083\n")
+	select {
+	case cfg := <-configs:
+		if cfg.Connect.Host != "http://b.example.com:8083" {
+			t.Errorf("unexpected host %q", cfg.Connect.Host)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for config change")
+	}
+
+	kv.set("connect:\n  poll-interval: 0\n")
+	select {
+	case cfg := <-configs:
+		t.Errorf("expected invalid config to be rejected, got %+v", cfg)
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for config change")
+	}
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mockConsul is a stand-in for the consul KV HTTP API, holding a single key and supporting
+// blocking queries.
+type mockConsul struct {
+	key string
+
+	mu      sync.Mutex
+	value   string
+	index   uint64
+	changed chan struct{}
+	token   string
+}
+
+func newMockConsul(key, value string) *mockConsul {
+	return &mockConsul{
+		key:     key,
+		value:   value,
+		index:   1,
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *mockConsul) set(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value = value
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *mockConsul) lastToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *mockConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.token = r.Header.Get("X-Consul-Token")
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+
+	if waitIndex, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); err == nil && waitIndex >= index {
+		wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(c.index, 10))
+	if r.URL.Path != "/v1/kv/"+c.key {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(c.value))
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// flagDef is a command line flag setting a config field.
+type flagDef struct {
+	name  string
+	env   string
+	usage string
+
+	// field returns a pointer to the string, int or []string the flag sets in cfg.
+	field func(cfg *Config) interface{}
+}
+
+var flagDefs = []flagDef{
+	{"connect.host", "KAFKA_CONNECT_HOST", "kafka connect REST API host to monitor",
+		func(c *Config) interface{} { return &c.Connect.Host }},
+	{"connect.poll-interval", "KAFKA_CONNECT_POLL_INTERVAL", "minimum interval, in seconds, between API polls",
+		func(c *Config) interface{} { return &c.Connect.PollInterval }},
+	{"connect.request-timeout", "KAFKA_CONNECT_REQUEST_TIMEOUT", "seconds allowed for each API call",
+		func(c *Config) interface{} { return &c.Connect.RequestTimeout }},
+	{"connect.retries", "KAFKA_CONNECT_RETRIES", "number of retries of failed API calls",
+		func(c *Config) interface{} { return &c.Connect.Retries }},
+	{"connect.snapshot-max-age", "KAFKA_CONNECT_SNAPSHOT_MAX_AGE", "seconds to serve the last snapshot while connect is unreachable",
+		func(c *Config) interface{} { return &c.Connect.SnapshotMaxAge }},
+	{"connect.max-connectors", "KAFKA_CONNECT_MAX_CONNECTORS", "maximum number of connectors per cluster, 0 for no limit",
+		func(c *Config) interface{} { return &c.Connect.MaxConnectors }},
+	{"web.listen-address", "WEB_LISTEN_ADDRESS", "address to listen on, as host:port or unix:///path, can be repeated",
+		func(c *Config) interface{} { return &c.Web.ListenAddress }},
+	{"web.socket-mode", "WEB_SOCKET_MODE", "octal file mode of the unix sockets listened on",
+		func(c *Config) interface{} { return &c.Web.SocketMode }},
+	{"prometheus.port", "PORT", "port to listen on",
+		func(c *Config) interface{} { return &c.Prometheus.Port }},
+	{"prometheus.namespace", "PROMETHEUS_NAMESPACE", "namespace of the connector metric names",
+		func(c *Config) interface{} { return &c.Prometheus.Namespace }},
+	{"prometheus.subsystem", "PROMETHEUS_SUBSYSTEM", "subsystem of the connector metric names",
+		func(c *Config) interface{} { return &c.Prometheus.Subsystem }},
+	{"prometheus.max-series", "PROMETHEUS_MAX_SERIES", "maximum number of connector series served, 0 for no limit",
+		func(c *Config) interface{} { return &c.Prometheus.MaxSeries }},
+	{"log.level", "LOG_LEVEL", "log level: debug, info, warn or error",
+		func(c *Config) interface{} { return &c.Logging.Level }},
+	{"log.format", "LOG_FORMAT", "log format: logfmt or json",
+		func(c *Config) interface{} { return &c.Logging.Format }},
+	{"metadata.file", "METADATA_FILE", "connector metadata catalog file",
+		func(c *Config) interface{} { return &c.Metadata.File }},
+}
+
+// Flags are command line flags overriding settings of the config. Only the flags set on
+// the command line override the config, so that their defaults don't hide the settings
+// of other sources.
+type Flags struct {
+	fs     *flag.FlagSet
+	values Config
+}
+
+// NewFlags registers a flag for each setting that can be set on the command line with fs.
+// Their names are the YAML keys of the settings, except for the "log." prefix of the
+// logging settings.
+func NewFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, values: *Default()}
+	for _, def := range flagDefs {
+		usage := fmt.Sprintf("%s (env %s)", def.usage, def.env)
+		switch p := def.field(&f.values).(type) {
+		case *string:
+			fs.StringVar(p, def.name, *p, usage)
+		case *int:
+			fs.IntVar(p, def.name, *p, usage)
+		case *[]string:
+			fs.Var((*listValue)(p), def.name, usage)
+		}
+	}
+	return f
+}
+
+// apply sets the settings of the flags set on the command line in cfg.
+func (f *Flags) apply(cfg *Config) {
+	if f == nil {
+		return
+	}
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	for _, def := range flagDefs {
+		if !set[def.name] {
+			continue
+		}
+		switch p := def.field(&f.values).(type) {
+		case *string:
+			*def.field(cfg).(*string) = *p
+		case *int:
+			*def.field(cfg).(*int) = *p
+		case *[]string:
+			*def.field(cfg).(*[]string) = *p
+		}
+	}
+}
+
+// listValue is a flag which can be repeated, or set to a comma separated list, as the
+// environment variables of lists are.
+type listValue []string
+
+func (v *listValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *listValue) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*v = append(*v, s)
+		}
+	}
+	return nil
+}
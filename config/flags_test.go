@@ -0,0 +1,76 @@
+package config_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+)
+
+func TestLoaderFlagsPrecedence(t *testing.T) {
+	path := writeTempFile(t, `
+connect:
+  host: http://file.example.com:8083
+  poll-interval: 30
+prometheus:
+  port: 9401
+  namespace: file
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Setenv("PORT", "9402")
+	defer os.Unsetenv("PORT")
+	os.Setenv("LOG_LEVEL", "warn")
+	defer os.Unsetenv("LOG_LEVEL")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := &config.Loader{Path: path, Flags: config.NewFlags(fs)}
+	err := fs.Parse([]string{
+		"--connect.poll-interval=5",
+		"--log.level", "debug",
+		"--web.listen-address", "127.0.0.1:9500",
+		"--web.listen-address", "unix:///run/exporter.sock",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := l.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Connect.Host != "http://file.example.com:8083" {
+		t.Errorf("expected host from file, got %q", cfg.Connect.Host)
+	}
+	if cfg.Connect.PollInterval != 5 {
+		t.Errorf("expected poll interval from flags, got %d", cfg.Connect.PollInterval)
+	}
+	if cfg.Prometheus.Namespace != "file" {
+		t.Errorf("expected namespace from file, not the flag default, got %q", cfg.Prometheus.Namespace)
+	}
+	if cfg.Prometheus.Port != 9402 {
+		t.Errorf("expected port from environment, got %d", cfg.Prometheus.Port)
+	}
+	if cfg.Logging.Level != "debug" {
+		t.Errorf("expected log level from flags, got %q", cfg.Logging.Level)
+	}
+	expectAddrs := []string{"127.0.0.1:9500", "unix:///run/exporter.sock"}
+	if addrs := cfg.ListenAddresses(); !reflect.DeepEqual(addrs, expectAddrs) {
+		t.Errorf("expected listen addresses %q from flags, got %q", expectAddrs, addrs)
+	}
+}
+
+func TestLoaderFlagsInvalidListenAddress(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := &config.Loader{Flags: config.NewFlags(fs)}
+	if err := fs.Parse([]string{"--connect.host=http://localhost:8083", "--web.listen-address=9500"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Load(context.Background()); err == nil {
+		t.Error("expected an error for a listen address without a port")
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/otlp"
+)
+
+// Resource attributes set on the metrics of each cluster exported over OTLP.
+const (
+	attrServiceName    = "service.name"
+	attrClusterName    = "kafka.connect.cluster.name"
+	attrClusterAddress = "server.address"
+	attrClusterPort    = "server.port"
+)
+
+// OTLP configures exporting the metrics of each cluster to an OTLP receiver, such as an
+// OpenTelemetry collector, every poll interval.
+type OTLP struct {
+	// Endpoint is the base URL of the receiver. Metrics are only exported if it is set.
+	Endpoint string `yaml:"endpoint,omitempty" env:"OTLP_ENDPOINT"`
+
+	// Protocol is grpc or http/protobuf.
+	Protocol string `yaml:"protocol,omitempty" env:"OTLP_PROTOCOL"`
+
+	// Headers are sent with every export, such as authorization headers.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// ResourceAttributes are added to the resource attributes of every cluster.
+	ResourceAttributes map[string]string `yaml:"resource-attributes,omitempty"`
+
+	// Timeout is the time allowed for each export, in seconds.
+	Timeout int `yaml:"timeout,omitempty" env:"OTLP_TIMEOUT"`
+}
+
+// Exporter returns an exporter to the configured receiver, or nil if none is configured.
+func (o OTLP) Exporter() (*otlp.Exporter, error) {
+	if o.Endpoint == "" {
+		return nil, nil
+	}
+	protocol, err := otlp.ParseProtocol(o.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	e := otlp.NewExporter(o.Endpoint, protocol, time.Duration(o.Timeout)*time.Second)
+	e.Headers = o.Headers
+	return e, nil
+}
+
+// Resource returns the resource attributes of the cluster of the given name and host:
+// the configured attributes, the name of the service, unless configured, and the name,
+// address and port of the cluster.
+func (c *Config) Resource(name, host string) map[string]string {
+	attrs := map[string]string{attrServiceName: "kafka-connect-exporter"}
+	for k, v := range c.OTLP.ResourceAttributes {
+		attrs[k] = v
+	}
+	attrs[attrClusterName] = name
+	if u, err := url.Parse(host); err == nil {
+		attrs[attrClusterAddress] = u.Hostname()
+		if port := u.Port(); port != "" {
+			attrs[attrClusterPort] = port
+		}
+	}
+	return attrs
+}
+
+// validate checks the OTLP settings, calling fail for each invalid one.
+func (o OTLP) validate(fail func(format string, args ...interface{})) {
+	if o.Endpoint == "" {
+		return
+	}
+	if err := validateHost(o.Endpoint); err != nil {
+		fail("otlp.endpoint: %s", err)
+	}
+	if _, err := otlp.ParseProtocol(o.Protocol); err != nil {
+		fail("otlp.protocol: %s", err)
+	}
+	if o.Timeout <= 0 {
+		fail("otlp.timeout must be positive, got %d", o.Timeout)
+	}
+}
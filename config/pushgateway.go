@@ -0,0 +1,116 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/pushgateway"
+	"github.com/autotraderuk/kafka-connect-exporter/transport"
+)
+
+// DefaultPushgatewayJob is the default job label of the groups pushed to a pushgateway.
+const DefaultPushgatewayJob = "kafka-connect-exporter"
+
+// Pushgateway configures pushing the metrics of each cluster to a prometheus pushgateway,
+// every poll interval, for environments which prometheus can't scrape.
+type Pushgateway struct {
+	// URL is the base URL of the pushgateway. Metrics are only pushed if it is set.
+	URL string `yaml:"url,omitempty" env:"PUSHGATEWAY_URL"`
+
+	// Job is the job label of the groups pushed to.
+	Job string `yaml:"job,omitempty" env:"PUSHGATEWAY_JOB"`
+
+	// Grouping are labels added to the grouping key of every cluster, along with the
+	// cluster label.
+	Grouping map[string]string `yaml:"grouping,omitempty"`
+
+	// Username and Password authenticate pushes with basic auth, and BearerToken with a
+	// bearer token.
+	Username    string `yaml:"username,omitempty" env:"PUSHGATEWAY_USERNAME"`
+	Password    string `yaml:"password,omitempty" env:"PUSHGATEWAY_PASSWORD"`
+	BearerToken string `yaml:"bearer-token,omitempty" env:"PUSHGATEWAY_BEARER_TOKEN"`
+
+	// Retries is the number of retries of failed pushes, and Timeout the time allowed for
+	// each attempt, in seconds.
+	Retries int `yaml:"retries,omitempty" env:"PUSHGATEWAY_RETRIES"`
+	Timeout int `yaml:"timeout,omitempty" env:"PUSHGATEWAY_TIMEOUT"`
+
+	// KeepOnShutdown keeps the groups pushed when the exporter shuts down, rather than
+	// deleting them.
+	KeepOnShutdown bool `yaml:"keep-on-shutdown,omitempty" env:"PUSHGATEWAY_KEEP_ON_SHUTDOWN"`
+}
+
+// Pusher returns a pusher to the configured pushgateway, or nil if none is configured.
+func (p Pushgateway) Pusher() *pushgateway.Pusher {
+	if p.URL == "" {
+		return nil
+	}
+	retries := p.Retries
+	if retries == 0 {
+		retries = -1
+	}
+	rt := &transport.Retry{
+		MaxRetries: retries,
+		Timeout:    time.Duration(p.Timeout) * time.Second,
+	}
+	return &pushgateway.Pusher{
+		URL:         p.URL,
+		Job:         p.Job,
+		Username:    p.Username,
+		Password:    p.Password,
+		BearerToken: p.BearerToken,
+		Client:      &http.Client{Transport: rt},
+	}
+}
+
+// Grouping returns the grouping key labels of the cluster of the given name.
+func (c *Config) Grouping(cluster string) map[string]string {
+	grouping := map[string]string{c.clusterLabel(): cluster}
+	for name, value := range c.Pushgateway.Grouping {
+		grouping[name] = value
+	}
+	return grouping
+}
+
+// clusterLabel returns the name of the cluster label, which may be renamed.
+func (c *Config) clusterLabel() string {
+	if name, ok := c.Prometheus.LabelNames[prometheus.LabelCluster]; ok {
+		return name
+	}
+	return prometheus.LabelCluster
+}
+
+// validate checks the pushgateway settings, calling fail for each invalid one.
+func (p Pushgateway) validate(clusterLabel string, fail func(format string, args ...interface{})) {
+	if p.URL == "" {
+		return
+	}
+	if err := validateHost(p.URL); err != nil {
+		fail("pushgateway.url: %s", err)
+	}
+	if p.Job == "" {
+		fail("pushgateway.job must be set")
+	}
+	for name := range p.Grouping {
+		switch {
+		case !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__"):
+			fail("pushgateway.grouping: %q is not a valid label name", name)
+		case name == "job" || name == clusterLabel:
+			fail("pushgateway.grouping: label %q is reserved", name)
+		}
+	}
+	if p.BearerToken != "" && p.Username != "" {
+		fail("pushgateway.username and pushgateway.bearer-token are mutually exclusive")
+	}
+	if p.Password != "" && p.Username == "" {
+		fail("pushgateway.username must be set when pushgateway.password is set")
+	}
+	if p.Retries < 0 {
+		fail("pushgateway.retries must not be negative, got %d", p.Retries)
+	}
+	if p.Timeout <= 0 {
+		fail("pushgateway.timeout must be positive, got %d", p.Timeout)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/remotewrite"
+)
+
+// RemoteWrite configures sending the metrics of each cluster to a prometheus remote-write
+// endpoint after each poll, for exporters which prometheus can't scrape.
+type RemoteWrite struct {
+	// URL is the remote-write endpoint. Metrics are only sent if it is set.
+	URL string `yaml:"url,omitempty" env:"REMOTE_WRITE_URL"`
+
+	// Username and Password authenticate requests with basic auth, and BearerToken with a
+	// bearer token.
+	Username    string `yaml:"username,omitempty" env:"REMOTE_WRITE_USERNAME"`
+	Password    string `yaml:"password,omitempty" env:"REMOTE_WRITE_PASSWORD"`
+	BearerToken string `yaml:"bearer-token,omitempty" env:"REMOTE_WRITE_BEARER_TOKEN"`
+
+	// Retries is the number of retries of requests failing with a 5xx status, and Timeout
+	// the time allowed for each attempt, in seconds.
+	Retries int `yaml:"retries,omitempty" env:"REMOTE_WRITE_RETRIES"`
+	Timeout int `yaml:"timeout,omitempty" env:"REMOTE_WRITE_TIMEOUT"`
+
+	// QueueCapacity is the number of polls whose samples are queued while the endpoint
+	// can't be reached, after which the oldest are dropped.
+	QueueCapacity int `yaml:"queue-capacity,omitempty" env:"REMOTE_WRITE_QUEUE_CAPACITY"`
+}
+
+// Queue returns a queue sending to the configured endpoint, or nil if none is configured.
+func (r RemoteWrite) Queue() *remotewrite.Queue {
+	if r.URL == "" {
+		return nil
+	}
+	retries := r.Retries
+	if retries == 0 {
+		retries = -1
+	}
+	return remotewrite.NewQueue(&remotewrite.Client{
+		URL:         r.URL,
+		Username:    r.Username,
+		Password:    r.Password,
+		BearerToken: r.BearerToken,
+		HTTPClient:  &http.Client{Timeout: time.Duration(r.Timeout) * time.Second},
+		MaxRetries:  retries,
+	}, r.QueueCapacity)
+}
+
+// validate checks the remote-write settings, calling fail for each invalid one.
+func (r RemoteWrite) validate(fail func(format string, args ...interface{})) {
+	if r.URL == "" {
+		return
+	}
+	if err := validateHost(r.URL); err != nil {
+		fail("remote-write.url: %s", err)
+	}
+	if r.BearerToken != "" && r.Username != "" {
+		fail("remote-write.username and remote-write.bearer-token are mutually exclusive")
+	}
+	if r.Password != "" && r.Username == "" {
+		fail("remote-write.username must be set when remote-write.password is set")
+	}
+	if r.Retries < 0 {
+		fail("remote-write.retries must not be negative, got %d", r.Retries)
+	}
+	if r.Timeout <= 0 {
+		fail("remote-write.timeout must be positive, got %d", r.Timeout)
+	}
+	if r.QueueCapacity <= 0 {
+		fail("remote-write.queue-capacity must be positive, got %d", r.QueueCapacity)
+	}
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRetryInterval is the time Loader.Watch waits before retrying a failed watch.
+	DefaultRetryInterval = 5 * time.Second
+
+	// DefaultFilePollInterval is the interval at which a FileSource checks its file for
+	// modifications.
+	DefaultFilePollInterval = 5 * time.Second
+)
+
+// Source is a location from which a YAML config document can be read.
+type Source interface {
+	// String describes the source, for use in errors and logs.
+	String() string
+
+	// Read returns the current config document held by the source. An empty document
+	// is returned if the source holds none.
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// Watcher is a Source that can wait for its config document to change.
+type Watcher interface {
+	Source
+
+	// Watch blocks until the config document differs from the one last returned by Read
+	// or Watch, and returns the new document. It returns early if ctx is done.
+	Watch(ctx context.Context) ([]byte, error)
+}
+
+// FileSource is a Watcher reading a local file. Modifications are detected by polling.
+type FileSource struct {
+	// PollInterval is the interval at which the file is checked for modifications. It
+	// defaults to DefaultFilePollInterval.
+	PollInterval time.Duration
+
+	path string
+
+	mu   sync.Mutex
+	last []byte
+}
+
+// NewFileSource returns a source reading the file at path.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) String() string {
+	return "file " + s.path
+}
+
+// Read returns the contents of the file.
+func (s *FileSource) Read(ctx context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.last = data
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Watch polls the file until its contents differ from those last returned by Read or
+// Watch, and returns the new contents. Errors reading the file while polling are
+// returned immediately.
+func (s *FileSource) Watch(ctx context.Context) ([]byte, error) {
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = DefaultFilePollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		data, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		changed := !bytes.Equal(data, s.last)
+		s.last = data
+		s.mu.Unlock()
+		if changed {
+			return data, nil
+		}
+	}
+}
+
+// Loader loads config from a local file and from the remote source, if any, that the
+// local config points to.
+type Loader struct {
+	// Path is the local config file. If empty, no file is read.
+	Path string
+
+	// Flags, if set, override the settings of every other source.
+	Flags *Flags
+
+	// RetryInterval is the time Watch waits before retrying a failed watch. It defaults
+	// to DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	// FilePollInterval is the interval at which Watch checks the local file for
+	// modifications. It defaults to DefaultFilePollInterval.
+	FilePollInterval time.Duration
+
+	mu           sync.Mutex
+	local        *FileSource
+	remote       Source
+	remoteConfig Consul
+}
+
+// Load returns the config built from defaults, the remote source, the local file,
+// environment variables and flags, in that order of precedence. The result is validated before it
+// is returned.
+func (l *Loader) Load(ctx context.Context) (*Config, error) {
+	local, err := l.readLocal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the local config decides which remote source, if any, to read from.
+	bootstrap, err := build(l.Flags, local)
+	if err != nil {
+		return nil, err
+	}
+	remote := l.setRemote(bootstrap.Config.Consul)
+	if remote == nil {
+		return validated(bootstrap)
+	}
+
+	data, err := remote.Read(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config from %s", remote)
+	}
+	cfg, err := build(l.Flags, document{source: remote, data: data}, local)
+	if err != nil {
+		return nil, err
+	}
+	return validated(cfg)
+}
+
+// Watch blocks until ctx is done, reloading the config each time the local file or the
+// remote source changes, and calling fn with the result. If watching or reloading fails,
+// fn is called with the error instead. Calls to fn are never concurrent.
+func (l *Loader) Watch(ctx context.Context, fn func(*Config, error)) {
+	var mu sync.Mutex
+	reload := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			fn(nil, err)
+			return
+		}
+		fn(l.Load(ctx))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		l.watch(ctx, l.localSource, reload)
+	}()
+	go func() {
+		defer wg.Done()
+		l.watch(ctx, l.current, reload)
+	}()
+	wg.Wait()
+}
+
+// watch repeatedly watches the source returned by src, which may change between calls,
+// calling reload after each change or error.
+func (l *Loader) watch(ctx context.Context, src func() Source, reload func(error)) {
+	retry := l.RetryInterval
+	if retry == 0 {
+		retry = DefaultRetryInterval
+	}
+
+	wait := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(retry):
+			return true
+		}
+	}
+
+	for {
+		// until the config changes, there may be nothing to watch.
+		w, ok := src().(Watcher)
+		if !ok {
+			if !wait() {
+				return
+			}
+			continue
+		}
+		_, err := w.Watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			reload(errors.Wrapf(err, "watching config in %s", w))
+			if !wait() {
+				return
+			}
+			continue
+		}
+		reload(nil)
+	}
+}
+
+func (l *Loader) readLocal(ctx context.Context) (document, error) {
+	src := l.localSource()
+	if src == nil {
+		return document{}, nil
+	}
+	data, err := src.Read(ctx)
+	if err != nil {
+		return document{}, errors.Wrap(err, "reading config file")
+	}
+	return document{source: src, data: data}, nil
+}
+
+func (l *Loader) localSource() Source {
+	if l.Path == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.local == nil {
+		l.local = NewFileSource(l.Path)
+		l.local.PollInterval = l.FilePollInterval
+	}
+	return l.local
+}
+
+func (l *Loader) current() Source {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remote
+}
+
+// setRemote replaces the remote source, unless it is already configured as given, and
+// returns it.
+func (l *Loader) setRemote(cfg Consul) Source {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cfg == l.remoteConfig {
+		return l.remote
+	}
+	l.remoteConfig = cfg
+	l.remote = nil
+	if cfg.Host != "" && cfg.Path != "" {
+		l.remote = NewConsulSource(cfg)
+	}
+	return l.remote
+}
+
+func validated(cfg *Config) (*Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,59 @@
+package config_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+)
+
+func TestLoaderWatchFile(t *testing.T) {
+	path := writeTempFile(t, "connect:\n  host: http://a.example.com:8083\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	l := &config.Loader{Path: path, FilePollInterval: 10 * time.Millisecond}
+	if _, err := l.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	configs := make(chan *config.Config)
+	errs := make(chan error)
+	go l.Watch(ctx, func(cfg *config.Config, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		configs <- cfg
+	})
+
+	for _, tc := range []struct {
+		content   string
+		expectErr bool
+	}{
+		{content: "connect:\n  host: http://b.example.com:8083\n"},
+		{content: "connect:\n  host: ftp://b.example.com\n", expectErr: true},
+		{content: "connect:\n  host: http://c.example.com:8083\n"},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case cfg := <-configs:
+			if tc.expectErr {
+				t.Fatalf("expected error for %q, got %+v", tc.content, cfg)
+			}
+		case err := <-errs:
+			if !tc.expectErr {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for config change")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/statsd"
+)
+
+// StatsD configures emitting the gauges of each cluster to a StatsD server, such as a
+// Datadog agent.
+type StatsD struct {
+	// Address is the host:port of the server, sent to over UDP, or unix:///path for a unix
+	// datagram socket. Gauges are only emitted if it is set.
+	Address string `yaml:"address,omitempty" env:"STATSD_ADDRESS"`
+
+	// Prefix is prepended to the metric names.
+	Prefix string `yaml:"prefix,omitempty" env:"STATSD_PREFIX"`
+
+	// Tags sends labels as DogStatsD tags. Otherwise label values are appended to the
+	// metric names.
+	Tags bool `yaml:"tags" env:"STATSD_TAGS"`
+
+	// Interval, if set, is the minimum time between two emits of a cluster, in seconds.
+	// Otherwise the gauges of a cluster are emitted after each of its collections.
+	Interval int `yaml:"interval,omitempty" env:"STATSD_INTERVAL"`
+}
+
+// StatsDEmitter returns an emitter to the configured server, or nil if none is
+// configured, and the minimum interval between two emits of a cluster, which is zero if
+// every collection is emitted.
+func (c *Config) StatsDEmitter() (*statsd.Emitter, time.Duration, error) {
+	if c.StatsD.Address == "" {
+		return nil, 0, nil
+	}
+	e, err := statsd.NewEmitter(c.StatsD.Address)
+	if err != nil {
+		return nil, 0, err
+	}
+	e.Prefix = c.StatsD.Prefix
+	e.Tags = c.StatsD.Tags
+
+	return e, time.Duration(c.StatsD.Interval) * time.Second, nil
+}
+
+// validate checks the StatsD settings, calling fail for each invalid one.
+func (s StatsD) validate(fail func(format string, args ...interface{})) {
+	if s.Address == "" {
+		return
+	}
+	if _, _, err := statsd.ParseAddress(s.Address); err != nil {
+		fail("statsd.address: %s", err)
+	}
+	if s.Interval < 0 {
+		fail("statsd.interval must not be negative, got %d", s.Interval)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// unixScheme prefixes the listen addresses of unix domain sockets.
+const unixScheme = "unix://"
+
+// Web configures the exporter's HTTP server.
+type Web struct {
+	// ListenAddress lists the addresses the exporter listens on, as host:port, or
+	// unix:///path for a unix domain socket. It defaults to the prometheus port, on every
+	// interface.
+	ListenAddress []string `yaml:"listen-address,omitempty" env:"WEB_LISTEN_ADDRESS"`
+
+	// SocketMode is the octal file mode of the unix domain sockets listened on.
+	SocketMode string `yaml:"socket-mode,omitempty" env:"WEB_SOCKET_MODE"`
+}
+
+// FileMode returns the file mode of the unix domain sockets listened on.
+func (w Web) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(w.SocketMode, 8, 32)
+	if err != nil || mode&^uint64(os.ModePerm) != 0 {
+		return 0, errors.Errorf("invalid file mode %q, expected octal permissions such as 0660", w.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseListenAddress returns the network and address to listen on for a listen address,
+// which is "unix" and the path of the socket for unix:///path, and "tcp" and host:port
+// otherwise.
+func ParseListenAddress(addr string) (network, address string, err error) {
+	if strings.HasPrefix(addr, unixScheme) {
+		path := strings.TrimPrefix(addr, unixScheme)
+		if !filepath.IsAbs(path) {
+			return "", "", errors.Errorf("%q is not an absolute socket path, expected unix:///path", addr)
+		}
+		return "unix", path, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", err
+	}
+	return "tcp", addr, nil
+}
@@ -0,0 +1,79 @@
+package config_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+)
+
+type listenAddressTestCase struct {
+	name    string
+	addr    string
+	network string
+	address string
+	err     bool
+}
+
+func TestParseListenAddress(t *testing.T) {
+	testCases := []listenAddressTestCase{
+		{name: "port", addr: ":9400", network: "tcp", address: ":9400"},
+		{name: "host and port", addr: "10.0.0.1:9400", network: "tcp", address: "10.0.0.1:9400"},
+		{name: "ipv6", addr: "[::1]:9400", network: "tcp", address: "[::1]:9400"},
+		{name: "unix socket", addr: "unix:///run/exporter.sock", network: "unix", address: "/run/exporter.sock"},
+		{name: "relative unix socket", addr: "unix://exporter.sock", err: true},
+		{name: "missing port", addr: "10.0.0.1", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc listenAddressTestCase) assert(t *testing.T) {
+	network, address, err := config.ParseListenAddress(tc.addr)
+	if tc.err {
+		if err == nil {
+			t.Errorf("expected an error, got %s %s", network, address)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network != tc.network || address != tc.address {
+		t.Errorf("expected %s %s, got %s %s", tc.network, tc.address, network, address)
+	}
+}
+
+func TestWebFileMode(t *testing.T) {
+	mode, err := config.Default().Web.FileMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != 0660 {
+		t.Errorf("expected default mode 0660, got %o", mode)
+	}
+	for _, invalid := range []string{"", "rw-rw----", "0999", "10777"} {
+		if _, err := (config.Web{SocketMode: invalid}).FileMode(); err == nil {
+			t.Errorf("expected an error for mode %q", invalid)
+		}
+	}
+}
+
+func TestListenAddressesEnv(t *testing.T) {
+	os.Setenv("KAFKA_CONNECT_HOST", "http://localhost:8083")
+	defer os.Unsetenv("KAFKA_CONNECT_HOST")
+	os.Setenv("WEB_LISTEN_ADDRESS", "127.0.0.1:9400,unix:///run/exporter.sock")
+	defer os.Unsetenv("WEB_LISTEN_ADDRESS")
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"127.0.0.1:9400", "unix:///run/exporter.sock"}
+	if addrs := cfg.ListenAddresses(); !reflect.DeepEqual(addrs, expect) {
+		t.Errorf("expected %q, got %q", expect, addrs)
+	}
+}
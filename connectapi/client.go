@@ -0,0 +1,380 @@
+// Package connectapi is a client for the kafka connect REST API.
+//
+// Every endpoint of the API is covered. Endpoints added in later versions of kafka
+// connect check the version of the workers first, and fail with an UnsupportedError if
+// they are too old. Failed calls return an APIError. Connector and logger names are
+// escaped in URLs, so they may contain any character.
+package connectapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Client calls the REST API of a kafka connect cluster. It is safe for concurrent use.
+type Client struct {
+	// HTTPClient is used to make requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// UserAgent, if set, is sent with every request.
+	UserAgent string
+
+	base *url.URL
+
+	mu      sync.Mutex
+	version *Version
+}
+
+// NewClient returns a client for the API at host, such as "http://connect:8083". The
+// host may include a path prefix.
+func NewClient(host string) (*Client, error) {
+	base, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing kafka connect host")
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, errors.Errorf("kafka connect host %q must be an http or https URL", host)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+	return &Client{base: base}, nil
+}
+
+// Host returns the root URL of the API.
+func (c *Client) Host() string {
+	return c.base.String()
+}
+
+// ServerInfo returns the version of the worker handling the request.
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info := new(ServerInfo)
+	return info, c.do(ctx, "GET", path(), nil, nil, info)
+}
+
+// Version returns the apache kafka version of the workers. It is requested once, and
+// cached.
+func (c *Client) Version(ctx context.Context) (Version, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != nil {
+		return *c.version, nil
+	}
+	info, err := c.ServerInfo(ctx)
+	if err != nil {
+		return Version{}, errors.Wrap(err, "detecting kafka connect version")
+	}
+	v, err := ParseVersion(info.Version)
+	if err != nil {
+		return Version{}, errors.Wrap(err, "detecting kafka connect version")
+	}
+	c.version = &v
+	return v, nil
+}
+
+// require fails with an UnsupportedError if the workers are older than since.
+func (c *Client) require(ctx context.Context, endpoint string, since Version) error {
+	v, err := c.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if v.Less(since) {
+		return &UnsupportedError{Endpoint: endpoint, Since: since, Version: v}
+	}
+	return nil
+}
+
+// ListConnectors returns the names of the connectors.
+func (c *Client) ListConnectors(ctx context.Context) ([]string, error) {
+	var names []string
+	return names, c.do(ctx, "GET", path("connectors"), nil, nil, &names)
+}
+
+// ListConnectorsExpanded returns every connector, by name, with its status and info as
+// requested, in a single call.
+func (c *Client) ListConnectorsExpanded(ctx context.Context, status, info bool) (map[string]ConnectorExpanded, error) {
+	if err := c.require(ctx, "expanded connector listing", Version2_3); err != nil {
+		return nil, err
+	}
+	query := make(url.Values)
+	if status {
+		query.Add("expand", "status")
+	}
+	if info {
+		query.Add("expand", "info")
+	}
+	connectors := make(map[string]ConnectorExpanded)
+	return connectors, c.do(ctx, "GET", path("connectors"), query, nil, &connectors)
+}
+
+// CreateConnector creates a connector with the given name and config.
+func (c *Client) CreateConnector(ctx context.Context, name string, config ConnectorConfig) (*ConnectorInfo, error) {
+	info := new(ConnectorInfo)
+	body := struct {
+		Name   string          `json:"name"`
+		Config ConnectorConfig `json:"config"`
+	}{name, config}
+	return info, c.do(ctx, "POST", path("connectors"), nil, body, info)
+}
+
+// GetConnector returns the definition of a connector.
+func (c *Client) GetConnector(ctx context.Context, name string) (*ConnectorInfo, error) {
+	info := new(ConnectorInfo)
+	return info, c.do(ctx, "GET", path("connectors", name), nil, nil, info)
+}
+
+// GetConnectorConfig returns the config of a connector.
+func (c *Client) GetConnectorConfig(ctx context.Context, name string) (ConnectorConfig, error) {
+	config := make(ConnectorConfig)
+	return config, c.do(ctx, "GET", path("connectors", name, "config"), nil, nil, &config)
+}
+
+// PutConnectorConfig creates a connector, or updates the config of an existing one.
+func (c *Client) PutConnectorConfig(ctx context.Context, name string, config ConnectorConfig) (*ConnectorInfo, error) {
+	info := new(ConnectorInfo)
+	return info, c.do(ctx, "PUT", path("connectors", name, "config"), nil, config, info)
+}
+
+// GetConnectorStatus returns the state of a connector and its tasks.
+func (c *Client) GetConnectorStatus(ctx context.Context, name string) (*ConnectorStatus, error) {
+	status := new(ConnectorStatus)
+	return status, c.do(ctx, "GET", path("connectors", name, "status"), nil, nil, status)
+}
+
+// RestartConnector restarts a connector, and, depending on opts, its tasks. Options other
+// than the zero value require kafka connect 3.0 or later.
+func (c *Client) RestartConnector(ctx context.Context, name string, opts RestartOptions) error {
+	var query url.Values
+	if opts != (RestartOptions{}) {
+		if err := c.require(ctx, "restarting connector tasks", Version3_0); err != nil {
+			return err
+		}
+		query = url.Values{
+			"includeTasks": {strconv.FormatBool(opts.IncludeTasks)},
+			"onlyFailed":   {strconv.FormatBool(opts.OnlyFailed)},
+		}
+	}
+	return c.do(ctx, "POST", path("connectors", name, "restart"), query, nil, nil)
+}
+
+// PauseConnector pauses a connector and its tasks.
+func (c *Client) PauseConnector(ctx context.Context, name string) error {
+	return c.do(ctx, "PUT", path("connectors", name, "pause"), nil, nil, nil)
+}
+
+// ResumeConnector resumes a paused or stopped connector.
+func (c *Client) ResumeConnector(ctx context.Context, name string) error {
+	return c.do(ctx, "PUT", path("connectors", name, "resume"), nil, nil, nil)
+}
+
+// StopConnector stops a connector, shutting down its tasks.
+func (c *Client) StopConnector(ctx context.Context, name string) error {
+	if err := c.require(ctx, "stopping connectors", Version3_5); err != nil {
+		return err
+	}
+	return c.do(ctx, "PUT", path("connectors", name, "stop"), nil, nil, nil)
+}
+
+// DeleteConnector deletes a connector, stopping its tasks.
+func (c *Client) DeleteConnector(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", path("connectors", name), nil, nil, nil)
+}
+
+// GetConnectorTasks returns the definitions of a connector's tasks.
+func (c *Client) GetConnectorTasks(ctx context.Context, name string) ([]TaskInfo, error) {
+	var tasks []TaskInfo
+	return tasks, c.do(ctx, "GET", path("connectors", name, "tasks"), nil, nil, &tasks)
+}
+
+// GetTaskStatus returns the state of a single task.
+func (c *Client) GetTaskStatus(ctx context.Context, name string, task int) (*TaskState, error) {
+	status := new(TaskState)
+	return status, c.do(ctx, "GET", path("connectors", name, "tasks", strconv.Itoa(task), "status"), nil, nil, status)
+}
+
+// RestartTask restarts a single task.
+func (c *Client) RestartTask(ctx context.Context, name string, task int) error {
+	return c.do(ctx, "POST", path("connectors", name, "tasks", strconv.Itoa(task), "restart"), nil, nil, nil)
+}
+
+// GetConnectorTopics returns the topics a connector has used since it was created, or
+// since its topics were reset.
+func (c *Client) GetConnectorTopics(ctx context.Context, name string) ([]string, error) {
+	if err := c.require(ctx, "connector topics", Version2_5); err != nil {
+		return nil, err
+	}
+	var res map[string]struct {
+		Topics []string `json:"topics"`
+	}
+	if err := c.do(ctx, "GET", path("connectors", name, "topics"), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res[name].Topics, nil
+}
+
+// ResetConnectorTopics empties the set of topics a connector has used.
+func (c *Client) ResetConnectorTopics(ctx context.Context, name string) error {
+	if err := c.require(ctx, "connector topics", Version2_5); err != nil {
+		return err
+	}
+	return c.do(ctx, "PUT", path("connectors", name, "topics", "reset"), nil, nil, nil)
+}
+
+// GetConnectorOffsets returns the offsets of a connector.
+func (c *Client) GetConnectorOffsets(ctx context.Context, name string) (*ConnectorOffsets, error) {
+	if err := c.require(ctx, "connector offsets", Version3_6); err != nil {
+		return nil, err
+	}
+	offsets := new(ConnectorOffsets)
+	return offsets, c.do(ctx, "GET", path("connectors", name, "offsets"), nil, nil, offsets)
+}
+
+// AlterConnectorOffsets changes the offsets of a stopped connector.
+func (c *Client) AlterConnectorOffsets(ctx context.Context, name string, offsets ConnectorOffsets) error {
+	if err := c.require(ctx, "connector offsets", Version3_6); err != nil {
+		return err
+	}
+	return c.do(ctx, "PATCH", path("connectors", name, "offsets"), nil, offsets, nil)
+}
+
+// ResetConnectorOffsets resets the offsets of a stopped connector.
+func (c *Client) ResetConnectorOffsets(ctx context.Context, name string) error {
+	if err := c.require(ctx, "connector offsets", Version3_6); err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", path("connectors", name, "offsets"), nil, nil, nil)
+}
+
+// ListPlugins returns the connector plugins installed on the workers. If all is set,
+// converters and transformations are listed too, which requires kafka connect 3.2 or
+// later.
+func (c *Client) ListPlugins(ctx context.Context, all bool) ([]Plugin, error) {
+	var query url.Values
+	if all {
+		if err := c.require(ctx, "listing every plugin type", Version3_2); err != nil {
+			return nil, err
+		}
+		query = url.Values{"connectorsOnly": {"false"}}
+	}
+	var plugins []Plugin
+	return plugins, c.do(ctx, "GET", path("connector-plugins"), query, nil, &plugins)
+}
+
+// GetPluginConfig returns the definitions of the config keys of a plugin.
+func (c *Client) GetPluginConfig(ctx context.Context, plugin string) ([]ConfigKey, error) {
+	if err := c.require(ctx, "plugin config definitions", Version3_4); err != nil {
+		return nil, err
+	}
+	var keys []ConfigKey
+	return keys, c.do(ctx, "GET", path("connector-plugins", plugin, "config"), nil, nil, &keys)
+}
+
+// ValidateConfig validates a connector config against the definition of its plugin.
+func (c *Client) ValidateConfig(ctx context.Context, plugin string, config ConnectorConfig) (*ConfigValidation, error) {
+	validation := new(ConfigValidation)
+	return validation, c.do(ctx, "PUT", path("connector-plugins", plugin, "config", "validate"), nil, config, validation)
+}
+
+// ListLoggers returns the levels of the loggers of the worker handling the request, by
+// logger name.
+func (c *Client) ListLoggers(ctx context.Context) (map[string]LoggerLevel, error) {
+	if err := c.require(ctx, "admin loggers", Version2_4); err != nil {
+		return nil, err
+	}
+	loggers := make(map[string]LoggerLevel)
+	return loggers, c.do(ctx, "GET", path("admin", "loggers"), nil, nil, &loggers)
+}
+
+// GetLogger returns the level of a logger of the worker handling the request.
+func (c *Client) GetLogger(ctx context.Context, name string) (*LoggerLevel, error) {
+	if err := c.require(ctx, "admin loggers", Version2_4); err != nil {
+		return nil, err
+	}
+	level := new(LoggerLevel)
+	return level, c.do(ctx, "GET", path("admin", "loggers", name), nil, nil, level)
+}
+
+// SetLogger sets the level of a logger, and of its descendants, on the worker handling the
+// request. It returns the names of the loggers modified.
+func (c *Client) SetLogger(ctx context.Context, name, level string) ([]string, error) {
+	if err := c.require(ctx, "admin loggers", Version2_4); err != nil {
+		return nil, err
+	}
+	var modified []string
+	body := LoggerLevel{Level: level}
+	return modified, c.do(ctx, "PUT", path("admin", "loggers", name), nil, body, &modified)
+}
+
+// path returns the escaped API path made of the given segments.
+func path(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	return "/" + strings.Join(escaped, "/")
+}
+
+// do sends a request to the API, encoding body as JSON if it isn't nil, and decoding the
+// response into v if it isn't nil. Responses with a non-2xx status code are returned as
+// an APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, v interface{}) error {
+	u := *c.base
+	u.RawPath = c.base.EscapedPath() + path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		apiErr := &APIError{Method: method, URL: u.String(), StatusCode: res.StatusCode}
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+		json.Unmarshal(data, apiErr)
+		return apiErr
+	}
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil && err != io.EOF {
+		return errors.Wrapf(err, "decoding response to %s %s", method, u.String())
+	}
+	return nil
+}
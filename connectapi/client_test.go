@@ -0,0 +1,303 @@
+package connectapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+)
+
+// mockConnect is a stand-in for the kafka connect REST API. It records each request, and
+// serves the response registered for its method and escaped path, or a 404 error document.
+type mockConnect struct {
+	version string
+
+	mu        sync.Mutex
+	requests  []string
+	bodies    []string
+	responses map[string]mockResponse
+}
+
+type mockResponse struct {
+	status int
+	body   string
+}
+
+func newMockConnect(version string) *mockConnect {
+	return &mockConnect{version: version, responses: make(map[string]mockResponse)}
+}
+
+func (m *mockConnect) handle(request string, status int, body string) {
+	m.responses[request] = mockResponse{status, body}
+}
+
+func (m *mockConnect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := r.Method + " " + r.URL.EscapedPath()
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+
+	m.mu.Lock()
+	m.requests = append(m.requests, request)
+	m.bodies = append(m.bodies, string(body))
+	res, ok := m.responses[request]
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/":
+		json.NewEncoder(w).Encode(connectapi.ServerInfo{Version: m.version, Commit: "abc"})
+	case ok:
+		w.WriteHeader(res.status)
+		w.Write([]byte(res.body))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_code":404,"message":"not found"}`))
+	}
+}
+
+func newTestClient(t *testing.T, m *mockConnect) (*connectapi.Client, func()) {
+	srv := httptest.NewServer(m)
+	client, err := connectapi.NewClient(srv.URL)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return client, srv.Close
+}
+
+func TestClientConnectors(t *testing.T) {
+	m := newMockConnect("3.6.0")
+	m.handle("GET /connectors", 200, `["orders","a/b c"]`)
+	m.handle("GET /connectors/a%2Fb%20c/status", 200, `{
+		"name": "a/b c",
+		"connector": {"state": "RUNNING", "worker_id": "w1:8083"},
+		"tasks": [{"id": 0, "state": "FAILED", "worker_id": "w2:8083", "trace": "boom"}],
+		"type": "sink"
+	}`)
+	m.handle("GET /connectors/a%2Fb%20c/config", 200, `{"connector.class": "FileStreamSink"}`)
+	m.handle("POST /connectors/a%2Fb%20c/tasks/0/restart", 204, "")
+	m.handle("POST /connectors/a%2Fb%20c/restart?includeTasks=true&onlyFailed=true", 202, "")
+	m.handle("PUT /connectors/orders/pause", 202, "")
+	m.handle("PUT /connectors/orders/resume", 202, "")
+	m.handle("PUT /connectors/orders/stop", 204, "")
+	client, done := newTestClient(t, m)
+	defer done()
+	ctx := context.Background()
+
+	names, err := client.ListConnectors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"orders", "a/b c"}) {
+		t.Errorf("unexpected connectors %v", names)
+	}
+
+	status, err := client.GetConnectorStatus(ctx, "a/b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &connectapi.ConnectorStatus{
+		Name:      "a/b c",
+		Connector: connectapi.ConnectorState{State: connectapi.StateRunning, WorkerID: "w1:8083"},
+		Tasks:     []connectapi.TaskState{{ID: 0, State: connectapi.StateFailed, WorkerID: "w2:8083", Trace: "boom"}},
+		Type:      connectapi.TypeSink,
+	}
+	if !reflect.DeepEqual(status, expect) {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	config, err := client.GetConnectorConfig(ctx, "a/b c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["connector.class"] != "FileStreamSink" {
+		t.Errorf("unexpected config %v", config)
+	}
+
+	for _, call := range []func() error{
+		func() error { return client.RestartTask(ctx, "a/b c", 0) },
+		func() error {
+			return client.RestartConnector(ctx, "a/b c", connectapi.RestartOptions{IncludeTasks: true, OnlyFailed: true})
+		},
+		func() error { return client.PauseConnector(ctx, "orders") },
+		func() error { return client.ResumeConnector(ctx, "orders") },
+		func() error { return client.StopConnector(ctx, "orders") },
+	} {
+		if err := call(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClientPutConfig(t *testing.T) {
+	m := newMockConnect("3.6.0")
+	m.handle("PUT /connectors/orders/config", 201, `{"name":"orders","config":{"topics":"orders"},"tasks":[{"connector":"orders","task":0}],"type":"sink"}`)
+	client, done := newTestClient(t, m)
+	defer done()
+
+	info, err := client.PutConnectorConfig(context.Background(), "orders", connectapi.ConnectorConfig{"topics": "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tasks) != 1 || info.Tasks[0] != (connectapi.TaskID{Connector: "orders", Task: 0}) {
+		t.Errorf("unexpected connector %+v", info)
+	}
+	if got := strings.TrimSpace(m.bodies[0]); got != `{"topics":"orders"}` {
+		t.Errorf("unexpected request body %s", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	m := newMockConnect("3.6.0")
+	m.handle("GET /connectors", 409, `{"error_code":409,"message":"Cannot complete request momentarily due to stale configuration"}`)
+	client, done := newTestClient(t, m)
+	defer done()
+	ctx := context.Background()
+
+	_, err := client.ListConnectors(ctx)
+	if !connectapi.IsRebalancing(err) {
+		t.Errorf("expected a rebalancing error, got %v", err)
+	}
+	if apiErr, ok := err.(*connectapi.APIError); !ok || apiErr.ErrorCode != 409 || !strings.Contains(apiErr.Message, "stale configuration") {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	_, err = client.GetConnector(ctx, "missing")
+	if !connectapi.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+type versionTestCase struct {
+	name    string
+	version string
+	call    func(context.Context, *connectapi.Client) error
+	expect  []string
+	unsup   bool
+}
+
+func TestClientVersions(t *testing.T) {
+	topics := func(ctx context.Context, c *connectapi.Client) error {
+		_, err := c.GetConnectorTopics(ctx, "orders")
+		return err
+	}
+	offsets := func(ctx context.Context, c *connectapi.Client) error {
+		_, err := c.GetConnectorOffsets(ctx, "orders")
+		return err
+	}
+	restart := func(ctx context.Context, c *connectapi.Client) error {
+		return c.RestartConnector(ctx, "orders", connectapi.RestartOptions{})
+	}
+
+	testCases := []versionTestCase{
+		{
+			name:    "supported",
+			version: "2.8.1",
+			call:    topics,
+			expect:  []string{"GET /", "GET /connectors/orders/topics"},
+		},
+		{
+			name:    "unsupported",
+			version: "2.4.0",
+			call:    topics,
+			expect:  []string{"GET /"},
+			unsup:   true,
+		},
+		{
+			name:    "confluent platform",
+			version: "7.6.0-ccs",
+			call:    offsets,
+			expect:  []string{"GET /", "GET /connectors/orders/offsets"},
+		},
+		{
+			name:    "old confluent platform",
+			version: "6.2.0-ccs",
+			call:    offsets,
+			expect:  []string{"GET /"},
+			unsup:   true,
+		},
+		{
+			name:    "no version needed",
+			version: "1.0.0",
+			call:    restart,
+			expect:  []string{"POST /connectors/orders/restart"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc versionTestCase) assert(t *testing.T) {
+	m := newMockConnect(tc.version)
+	m.handle("GET /connectors/orders/topics", 200, `{"orders":{"topics":["orders"]}}`)
+	m.handle("GET /connectors/orders/offsets", 200, `{"offsets":[]}`)
+	m.handle("POST /connectors/orders/restart", 204, "")
+	client, done := newTestClient(t, m)
+	defer done()
+
+	// the version is detected once, so a second call only makes the endpoint request.
+	for i := 0; i < 2; i++ {
+		err := tc.call(context.Background(), client)
+		if connectapi.IsUnsupported(err) != tc.unsup {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !tc.unsup && err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := tc.expect
+	if len(expect) > 0 && expect[0] == "GET /" {
+		expect = append(expect, expect[1:]...)
+	} else {
+		expect = append(expect, expect...)
+	}
+	if !reflect.DeepEqual(m.requests, expect) {
+		t.Errorf("expected requests %v, got %v", expect, m.requests)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for s, expect := range map[string]connectapi.Version{
+		"3.6.1":          {3, 6, 1},
+		"2.8":            {2, 8, 0},
+		"3.7.0-SNAPSHOT": {3, 7, 0},
+		"5.5.1-ccs":      {2, 5, 1},
+		"6.1.0-ce":       {2, 7, 0},
+		"7.5.0-ccs":      {3, 5, 0},
+	} {
+		got, err := connectapi.ParseVersion(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+		} else if got != expect {
+			t.Errorf("%s: expected %s, got %s", s, expect, got)
+		}
+	}
+	if _, err := connectapi.ParseVersion("latest"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestNewClientPathPrefix(t *testing.T) {
+	m := newMockConnect("3.6.0")
+	m.handle("GET /proxy/connect/connectors", 200, `[]`)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	client, err := connectapi.NewClient(srv.URL + "/proxy/connect/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListConnectors(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package connectapi
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is returned when the API responds with a non-2xx status code.
+type APIError struct {
+	// Method and URL identify the request.
+	Method string `json:"-"`
+	URL    string `json:"-"`
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"-"`
+
+	// ErrorCode and Message are taken from the error document in the response body, if
+	// there is one.
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// UnsupportedError is returned when an endpoint isn't available in the version of kafka
+// connect the client talks to.
+type UnsupportedError struct {
+	// Endpoint describes the unsupported endpoint.
+	Endpoint string
+
+	// Since is the first kafka connect version supporting the endpoint.
+	Since Version
+
+	// Version is the version of kafka connect the client talks to.
+	Version Version
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s requires kafka connect %s or later, got %s", e.Endpoint, e.Since, e.Version)
+}
+
+// StatusCode returns the HTTP status code of the API error at the cause of err, or 0 if
+// there is none.
+func StatusCode(err error) int {
+	if e, ok := errors.Cause(err).(*APIError); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is caused by a 404 response, for example for a connector
+// that doesn't exist.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsRebalancing reports whether err is caused by a 409 response, which kafka connect
+// returns while the workers are rebalancing.
+func IsRebalancing(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsUnsupported reports whether err is caused by an endpoint that isn't available in the
+// version of kafka connect the client talks to.
+func IsUnsupported(err error) bool {
+	_, ok := errors.Cause(err).(*UnsupportedError)
+	return ok
+}
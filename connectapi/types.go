@@ -0,0 +1,152 @@
+package connectapi
+
+// ServerInfo describes a kafka connect worker, as returned by the root endpoint.
+type ServerInfo struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	KafkaClusterID string `json:"kafka_cluster_id"`
+}
+
+// ConnectorConfig is the config of a connector, or of one of its tasks.
+type ConnectorConfig map[string]string
+
+// TaskID identifies a task of a connector.
+type TaskID struct {
+	Connector string `json:"connector"`
+	Task      int    `json:"task"`
+}
+
+// Connector types, as reported in ConnectorInfo and ConnectorStatus.
+const (
+	TypeSource = "source"
+	TypeSink   = "sink"
+)
+
+// Connector and task states, as reported in ConnectorStatus.
+const (
+	StateUnassigned = "UNASSIGNED"
+	StateRunning    = "RUNNING"
+	StatePaused     = "PAUSED"
+	StateStopped    = "STOPPED"
+	StateFailed     = "FAILED"
+	StateRestarting = "RESTARTING"
+)
+
+// ConnectorInfo is the definition of a connector.
+type ConnectorInfo struct {
+	Name   string          `json:"name"`
+	Config ConnectorConfig `json:"config"`
+	Tasks  []TaskID        `json:"tasks"`
+	Type   string          `json:"type,omitempty"`
+}
+
+// ConnectorState is the state of a connector, or of one of its tasks.
+type ConnectorState struct {
+	State    string `json:"state"`
+	WorkerID string `json:"worker_id"`
+
+	// Trace is the stack trace of the failure of a FAILED connector or task.
+	Trace string `json:"trace,omitempty"`
+}
+
+// TaskState is the state of a single task.
+type TaskState struct {
+	ID       int    `json:"id"`
+	State    string `json:"state"`
+	WorkerID string `json:"worker_id"`
+
+	// Trace is the stack trace of the failure of a FAILED task.
+	Trace string `json:"trace,omitempty"`
+}
+
+// ConnectorStatus is the state of a connector and its tasks.
+type ConnectorStatus struct {
+	Name      string         `json:"name"`
+	Connector ConnectorState `json:"connector"`
+	Tasks     []TaskState    `json:"tasks"`
+	Type      string         `json:"type,omitempty"`
+}
+
+// ConnectorExpanded is a connector as returned by ListConnectorsExpanded. Each field is
+// only set if it was requested.
+type ConnectorExpanded struct {
+	Info   *ConnectorInfo   `json:"info,omitempty"`
+	Status *ConnectorStatus `json:"status,omitempty"`
+}
+
+// TaskInfo is the definition of a task.
+type TaskInfo struct {
+	ID     TaskID          `json:"id"`
+	Config ConnectorConfig `json:"config"`
+}
+
+// Plugin is a connector, converter or transformation plugin installed on the workers.
+type Plugin struct {
+	Class   string `json:"class"`
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+}
+
+// ConfigKey is the definition of a plugin config key.
+type ConfigKey struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Required      bool     `json:"required"`
+	DefaultValue  *string  `json:"default_value"`
+	Importance    string   `json:"importance"`
+	Documentation string   `json:"documentation"`
+	Group         string   `json:"group"`
+	OrderInGroup  int      `json:"order_in_group"`
+	Width         string   `json:"width"`
+	DisplayName   string   `json:"display_name"`
+	Dependents    []string `json:"dependents"`
+}
+
+// ConfigValue is the validated value of a config key.
+type ConfigValue struct {
+	Name              string   `json:"name"`
+	Value             *string  `json:"value"`
+	RecommendedValues []string `json:"recommended_values"`
+	Errors            []string `json:"errors"`
+	Visible           bool     `json:"visible"`
+}
+
+// ConfigInfo is the definition and validated value of a single config key.
+type ConfigInfo struct {
+	Definition ConfigKey   `json:"definition"`
+	Value      ConfigValue `json:"value"`
+}
+
+// ConfigValidation is the result of validating a connector config.
+type ConfigValidation struct {
+	Name       string       `json:"name"`
+	ErrorCount int          `json:"error_count"`
+	Groups     []string     `json:"groups"`
+	Configs    []ConfigInfo `json:"configs"`
+}
+
+// RestartOptions select what is restarted by RestartConnector.
+type RestartOptions struct {
+	// IncludeTasks restarts the connector's tasks along with the connector.
+	IncludeTasks bool
+
+	// OnlyFailed restricts the restart to the connector and tasks that have failed.
+	OnlyFailed bool
+}
+
+// ConnectorOffset is the offset of a connector for a single partition.
+type ConnectorOffset struct {
+	Partition map[string]interface{} `json:"partition"`
+	Offset    map[string]interface{} `json:"offset"`
+}
+
+// ConnectorOffsets are the offsets of a connector.
+type ConnectorOffsets struct {
+	Offsets []ConnectorOffset `json:"offsets"`
+}
+
+// LoggerLevel is the level of a logger.
+type LoggerLevel struct {
+	Level        string `json:"level"`
+	LastModified *int64 `json:"last_modified,omitempty"`
+}
@@ -0,0 +1,85 @@
+package connectapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Version is a kafka connect release version.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// Versions introducing endpoints, which the client checks before calling them.
+var (
+	Version2_3 = Version{2, 3, 0} // expanded connector listing
+	Version2_4 = Version{2, 4, 0} // admin loggers
+	Version2_5 = Version{2, 5, 0} // connector topics
+	Version3_0 = Version{3, 0, 0} // restarting a connector with its tasks
+	Version3_2 = Version{3, 2, 0} // listing every plugin type
+	Version3_4 = Version{3, 4, 0} // plugin config definitions
+	Version3_5 = Version{3, 5, 0} // stopping a connector
+	Version3_6 = Version{3, 6, 0} // connector offsets
+)
+
+// ParseVersion parses a version such as "3.6.1". Missing minor and patch numbers are zero,
+// and any suffix is ignored, except for confluent platform versions such as "7.5.0-ccs",
+// which are converted to the apache kafka version they are based on.
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	core, suffix := s, ""
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core, suffix = core[:i], core[i+1:]
+	}
+	parts := strings.SplitN(core, ".", 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}, errors.Errorf("invalid version %q", s)
+		}
+		switch i {
+		case 0:
+			v.Major = n
+		case 1:
+			v.Minor = n
+		case 2:
+			v.Patch = n
+		}
+	}
+	if suffix == "ccs" || suffix == "ce" {
+		v = confluentToKafka(v)
+	}
+	return v, nil
+}
+
+// confluentToKafka converts a confluent platform version to the apache kafka version it
+// is based on: 5.x is 2.x, 6.x is 2.(x+6), and 7.x is 3.x.
+func confluentToKafka(v Version) Version {
+	switch {
+	case v.Major == 5:
+		return Version{2, v.Minor, v.Patch}
+	case v.Major == 6:
+		return Version{2, v.Minor + 6, v.Patch}
+	case v.Major >= 7:
+		return Version{v.Major - 4, v.Minor, v.Patch}
+	}
+	return v
+}
+
+// Less reports whether v is an earlier version than o.
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/logging"
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
+	"github.com/autotraderuk/kafka-connect-exporter/otlp"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/pushgateway"
+	"github.com/autotraderuk/kafka-connect-exporter/remotewrite"
+	"github.com/autotraderuk/kafka-connect-exporter/statsd"
+	"github.com/autotraderuk/kafka-connect-exporter/status"
+	"github.com/autotraderuk/kafka-connect-exporter/transport"
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// exporter serves metrics for the kafka connect clusters in its current config. The
+// config, along with everything built from it, can be replaced while serving.
+type exporter struct {
+	mu    sync.RWMutex
+	state *state
+}
+
+// state is everything the exporter builds from a single config.
+type state struct {
+	cfg      *config.Config
+	log      *logging.Logger
+	clusters []*cluster
+	registry *prom.Registry
+
+	// metadata is nil if no metadata catalog is configured.
+	metadata *metadata.Store
+
+	// pusher is nil if no pushgateway is configured, otlp if no OTLP receiver is, statsd
+	// if no StatsD server is, and remoteWrite if no remote-write endpoint is.
+	pusher      *pushgateway.Pusher
+	otlp        *otlp.Exporter
+	statsd      *statsd.Emitter
+	remoteWrite *remotewrite.Queue
+
+	// statsdInterval is the minimum time between two emits of a cluster to StatsD.
+	statsdInterval time.Duration
+
+	// cancel stops the goroutines started for the state, and polling waits for the ones
+	// polling the clusters.
+	cancel  context.CancelFunc
+	polling sync.WaitGroup
+}
+
+// cluster is a single monitored kafka connect cluster.
+type cluster struct {
+	name    string
+	log     *logging.Logger
+	metrics *prometheus.Metrics
+
+	// registry holds the metrics of the cluster alone, pushed to the group of the
+	// cluster, which is identified by grouping, exported over OTLP as the metrics of
+	// resource, emitted to StatsD, and sent to the remote-write endpoint.
+	registry *prom.Registry
+	grouping map[string]string
+	resource map[string]string
+
+	// emitted is when the cluster was last emitted to StatsD. It is only used by the
+	// goroutine polling the cluster.
+	emitted time.Time
+}
+
+func newState(cfg *config.Config) (*state, error) {
+	base, err := cfg.MetricsOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := newLogger(cfg.Logging)
+	if err != nil {
+		return nil, err
+	}
+	st := &state{
+		cfg:      cfg,
+		log:      log,
+		registry: prom.NewRegistry(),
+	}
+	st.registry.MustRegister(newReloadCollector(base))
+	ctx, cancel := context.WithCancel(context.Background())
+	st.cancel = cancel
+	if cfg.Metadata.File != "" {
+		store, err := metadata.NewStore(cfg.Metadata.File, config.NewFileSource(cfg.Metadata.File))
+		if err != nil {
+			st.close(nil)
+			return nil, err
+		}
+		st.metadata = store
+		go store.Watch(ctx, func(err error) {
+			log.Error("reloading metadata catalog, keeping current catalog", err, "stage", "metadata")
+		})
+	}
+	for _, c := range cfg.Clusters() {
+		opts := base
+		if st.metadata != nil {
+			opts.Metadata = st.metadata
+		}
+		m, err := newMetrics(cfg, c, opts)
+		if err != nil {
+			st.close(nil)
+			return nil, err
+		}
+		if err := st.registry.Register(m); err != nil {
+			st.close(nil)
+			return nil, errors.Wrapf(err, "registering metrics for %s", c.Host)
+		}
+		name := c.Name
+		if name == "" {
+			name = c.Host
+		}
+		c := &cluster{
+			name:     name,
+			log:      log.With("cluster", name),
+			metrics:  m,
+			registry: prom.NewRegistry(),
+			grouping: cfg.Grouping(name),
+			resource: cfg.Resource(name, c.Host),
+		}
+		if err := c.registry.Register(m); err != nil {
+			st.close(nil)
+			return nil, errors.Wrapf(err, "registering metrics for %s", c.name)
+		}
+		st.clusters = append(st.clusters, c)
+	}
+
+	if st.otlp, err = cfg.OTLP.Exporter(); err != nil {
+		st.close(nil)
+		return nil, err
+	}
+	if st.statsd, st.statsdInterval, err = cfg.StatsDEmitter(); err != nil {
+		st.close(nil)
+		return nil, err
+	}
+	if st.remoteWrite = cfg.RemoteWrite.Queue(); st.remoteWrite != nil {
+		st.remoteWrite.OnError = func(err error) {
+			log.Error("sending to remote-write endpoint", err, "stage", "remote-write")
+		}
+		dropped := prom.NewCounterVec(
+			prom.CounterOpts{
+				Name:        base.ExporterMetricName("remote_write_samples_dropped_total"),
+				Help:        "samples dropped before they were sent to the remote-write endpoint, by reason",
+				ConstLabels: base.ConstLabels,
+			},
+			[]string{prometheus.LabelReason},
+		)
+		st.registry.MustRegister(dropped)
+		st.remoteWrite.OnDrop = func(reason string, samples int) {
+			dropped.WithLabelValues(reason).Add(float64(samples))
+		}
+	}
+	// set last, so that a state failing to build doesn't delete the groups of the current one.
+	st.pusher = cfg.Pushgateway.Pusher()
+
+	for _, c := range st.clusters {
+		st.polling.Add(1)
+		go st.poll(ctx, c)
+	}
+	if st.remoteWrite != nil {
+		st.polling.Add(1)
+		go func() {
+			defer st.polling.Done()
+			st.remoteWrite.Run(ctx)
+		}()
+	}
+	return st, nil
+}
+
+// newClient returns a client of the kafka connect API at host, which retries and times out
+// calls through the returned transport, as configured by cfg.
+func newClient(cfg *config.Config, host string) (*connectapi.Client, *transport.Retry, error) {
+	rt := cfg.Connect.Transport()
+	client, err := connectapi.NewClient(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.HTTPClient = &http.Client{Transport: rt}
+	return client, rt, nil
+}
+
+// newMetrics returns the metrics of the cluster, collected with a client configured by
+// cfg, and opts for the cluster.
+func newMetrics(cfg *config.Config, c config.Cluster, opts prometheus.Opts) (*prometheus.Metrics, error) {
+	client, rt, err := newClient(cfg, c.Host)
+	if err != nil {
+		return nil, err
+	}
+	opts.Cluster = c.Name
+	m := prometheus.NewMetricsWithOpts(client, opts)
+	rt.OnRetry = func(_ *http.Request, reason string) {
+		m.CountRetry(reason)
+	}
+	return m, nil
+}
+
+// poll refreshes the metrics of c every poll interval until ctx is done, so that the
+// exporter's readiness reflects whether kafka connect can be reached, even while nothing
+// scrapes it. Scrapes in between are served from the refreshed metrics, which are also
+// queued for remote-write, emitted to StatsD, pushed to the pushgateway, and exported
+// over OTLP, if configured.
+func (st *state) poll(ctx context.Context, c *cluster) {
+	defer st.polling.Done()
+	interval := time.Duration(st.cfg.Connect.PollInterval) * time.Second
+	for {
+		err := c.metrics.Refresh(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.log.Error("calling kafka connect API", err, st.connectorFields(err)...)
+		}
+		// queue for remote-write first, as pushes and exports may take up to their timeouts.
+		if st.remoteWrite != nil {
+			if err := st.remoteWrite.Enqueue(c.registry); err != nil {
+				c.log.Error("queueing for remote-write", err, "stage", "remote-write")
+			}
+		}
+		if st.statsd != nil && err == nil {
+			st.emit(c)
+		}
+		if st.pusher != nil {
+			if err := st.pusher.Push(ctx, c.registry, c.grouping); err != nil && ctx.Err() == nil {
+				c.log.Error("pushing to pushgateway", err, "stage", "push")
+			}
+		}
+		if st.otlp != nil {
+			if err := st.otlp.Export(ctx, c.resource, c.registry); err != nil && ctx.Err() == nil {
+				c.log.Error("exporting over OTLP", err, "stage", "otlp")
+			}
+		}
+		// wait from the end of the refresh, so that the next one isn't skipped as too recent.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// emit emits the gauges of c to StatsD, unless they were emitted less than the StatsD
+// interval ago.
+func (st *state) emit(c *cluster) {
+	if !c.emitted.IsZero() && time.Since(c.emitted) < st.statsdInterval {
+		return
+	}
+	c.emitted = time.Now()
+	if err := st.statsd.Emit(c.registry); err != nil {
+		c.log.Error("emitting to statsd", err, "stage", "statsd")
+	}
+}
+
+// serve serves srv on the listeners until serving fails or the exporter is stopped, then
+// closes the current state, which deletes its pushgateway groups.
+func (e *exporter) serve(srv *http.Server, listeners []net.Listener, timeout time.Duration) error {
+	err := graceful(srv, listeners, timeout)
+	st := e.current()
+	if err != nil {
+		st.log.Error("serving http", err, "stage", "serve")
+	}
+	st.close(nil)
+	return err
+}
+
+// close stops the state's goroutines, deletes the groups it pushed to the pushgateway
+// which the next state doesn't push to, and flushes its logger. next is nil when the
+// exporter shuts down, in which case every group is deleted, unless configured otherwise.
+func (st *state) close(next *state) {
+	st.cancel()
+	st.polling.Wait()
+	if st.statsd != nil {
+		st.statsd.Close()
+	}
+	if st.pusher != nil && (next != nil || !st.cfg.Pushgateway.KeepOnShutdown) {
+		st.deleteGroups(next)
+	}
+	st.log.Close()
+}
+
+// deleteGroups deletes the groups of the clusters of the state which next doesn't push to.
+func (st *state) deleteGroups(next *state) {
+	keep := make(map[string]bool)
+	if next != nil && next.pusher != nil {
+		for _, c := range next.clusters {
+			keep[next.pusher.GroupURL(c.grouping)] = true
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(st.cfg.Pushgateway.Timeout)*time.Second)
+	defer cancel()
+	for _, c := range st.clusters {
+		if keep[st.pusher.GroupURL(c.grouping)] {
+			continue
+		}
+		if err := st.pusher.Delete(ctx, c.grouping); err != nil {
+			c.log.Error("deleting pushgateway group", err, "stage", "push")
+		}
+	}
+}
+
+// newLogger returns a logger writing to stderr, and reporting errors to the reporters in
+// cfg.
+func newLogger(cfg config.Logging) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	format, err := logging.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	// reporters log their own failures without reporting them, to avoid loops.
+	base := logging.New(os.Stderr, level, format)
+	var reporters []logging.Reporter
+	add := func(name string, r *logging.HTTPReporter) {
+		r.OnError = func(err error) {
+			base.Warn("reporting error", "reporter", name, "err", err)
+		}
+		reporters = append(reporters, r)
+	}
+	if cfg.HTTP.URL != "" {
+		add("http", logging.NewHTTPReporter(cfg.HTTP.URL, cfg.HTTP.Token))
+	}
+	if cfg.Logentries.Token != "" {
+		add("logentries", logging.NewLogentriesReporter(cfg.Logentries.Token))
+	}
+	if cfg.Rollbar.Token != "" {
+		add("rollbar", logging.NewRollbarReporter(cfg.Rollbar.Token, cfg.Rollbar.Env))
+	}
+	return logging.New(os.Stderr, level, format, reporters...), nil
+}
+
+// apply replaces the exporter's state with one built from cfg. If that fails, the current
+// state is kept.
+func (e *exporter) apply(cfg *config.Config) error {
+	st, err := newState(cfg)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	old := e.state
+	e.state = st
+	e.mu.Unlock()
+
+	if old != nil {
+		go old.close(st)
+	}
+	return nil
+}
+
+func (e *exporter) current() *state {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.state
+}
+
+// ServeHTTP refreshes the metrics for every cluster, and serves them along with the
+// default prometheus registry, to which the configured constant labels are added. Clusters
+// that fail to refresh serve their last successful snapshot, until it is too old.
+//
+// Refreshes are cancelled shortly before the scrape timeout sent by prometheus, if any,
+// and the connectors collected by then are served.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st := e.current()
+	ctx, cancel := scrapeContext(r, time.Duration(st.cfg.Prometheus.ScrapeTimeoutMargin)*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, c := range st.clusters {
+		wg.Add(1)
+		go func(c *cluster) {
+			defer wg.Done()
+			if err := c.metrics.Refresh(ctx); err != nil {
+				c.log.Error("calling kafka connect API", err, st.connectorFields(err)...)
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	gatherers := prom.Gatherers{
+		prometheus.WithConstLabels(prom.DefaultGatherer, st.cfg.Prometheus.ConstLabels),
+		st.registry,
+	}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// scrapeContext returns the context of a scrape, which is done when the request is, or
+// margin before the scrape timeout sent by prometheus in the
+// X-Prometheus-Scrape-Timeout-Seconds header.
+func scrapeContext(r *http.Request, margin time.Duration) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - margin
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// Clusters returns the snapshots of every cluster, served by the JSON API. It implements
+// api.Source.
+func (e *exporter) Clusters() []api.Cluster {
+	st := e.current()
+	clusters := make([]api.Cluster, len(st.clusters))
+	for i, c := range st.clusters {
+		clusters[i] = api.Cluster{Name: c.name, Snapshot: c.metrics.Snapshot()}
+	}
+	return clusters
+}
+
+// serveHealthy reports that the exporter is running. It never calls the connect API.
+func (e *exporter) serveHealthy(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "OK")
+}
+
+// serveReady reports whether every cluster has been collected successfully within the
+// configured number of poll intervals, with the state of each cluster in the body. It
+// never calls the connect API.
+func (e *exporter) serveReady(w http.ResponseWriter, r *http.Request) {
+	st := e.current()
+	window := time.Duration(st.cfg.Prometheus.ReadyIntervals*st.cfg.Connect.PollInterval) * time.Second
+
+	status := http.StatusOK
+	var body bytes.Buffer
+	for _, c := range st.clusters {
+		last := c.metrics.LastSuccess()
+		switch {
+		case last.IsZero():
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&body, "%s: not collected yet\n", c.name)
+		case time.Since(last) > window:
+			status = http.StatusServiceUnavailable
+			fmt.Fprintf(&body, "%s: last collected %s ago\n", c.name, time.Since(last).Truncate(time.Second))
+		default:
+			fmt.Fprintf(&body, "%s: OK\n", c.name)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	body.WriteTo(w)
+}
+
+// serveStatus serves the status page at /, and a 404 for any other unknown path.
+func (e *exporter) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	refresh := time.Duration(e.current().cfg.Connect.PollInterval) * time.Second
+	status.ServePage(w, r, e.Clusters(), refresh)
+}
+
+// serveConfig serves the current config, with secrets redacted.
+func (e *exporter) serveConfig(w http.ResponseWriter, r *http.Request) {
+	e.current().cfg.ServeHTTP(w, r)
+}
+
+// connectorFields returns the catalog metadata of the connector an update failed for, as
+// structured log fields, so that reported errors link to the connector's owner and runbook.
+func (st *state) connectorFields(err error) []interface{} {
+	uerr, ok := err.(*prometheus.UpdateError)
+	if !ok || uerr.Connector == "" {
+		return nil
+	}
+	md, _ := st.metadata.Lookup(uerr.Connector)
+	return md.LogFields()
+}
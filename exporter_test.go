@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+)
+
+// mockPushgateway records the requests made to it.
+type mockPushgateway struct {
+	mu       sync.Mutex
+	requests []string
+	pushed   chan struct{}
+}
+
+func (pg *mockPushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pg.mu.Lock()
+	pg.requests = append(pg.requests, r.Method+" "+r.URL.Path)
+	pg.mu.Unlock()
+	if r.Method == "PUT" {
+		select {
+		case pg.pushed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (pg *mockPushgateway) deletes() []string {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	var deletes []string
+	for _, r := range pg.requests {
+		if strings.HasPrefix(r, "DELETE ") {
+			deletes = append(deletes, r)
+		}
+	}
+	return deletes
+}
+
+// mockConnect serves a kafka connect cluster without connectors.
+func mockConnect(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("expand") != "" {
+		fmt.Fprint(w, "{}")
+		return
+	}
+	fmt.Fprint(w, "[]")
+}
+
+type serveTestCase struct {
+	name           string
+	keepOnShutdown bool
+	deletes        []string
+}
+
+func TestExporterServeSIGTERM(t *testing.T) {
+	testCases := []serveTestCase{
+		{
+			name:    "deletes groups",
+			deletes: []string{"DELETE /metrics/job/kafka-connect-exporter/cluster/primary"},
+		},
+		{
+			name:           "keeps groups on shutdown",
+			keepOnShutdown: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc serveTestCase) assert(t *testing.T) {
+	pg := &mockPushgateway{pushed: make(chan struct{}, 1)}
+	pgSrv := httptest.NewServer(pg)
+	defer pgSrv.Close()
+	connectSrv := httptest.NewServer(http.HandlerFunc(mockConnect))
+	defer connectSrv.Close()
+
+	dir, err := ioutil.TempDir("", "exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	doc := fmt.Sprintf(`
+connect:
+  clusters:
+    - name: primary
+      host: %s
+pushgateway:
+  url: %s
+  keep-on-shutdown: %t
+`, connectSrv.URL, pgSrv.URL, tc.keepOnShutdown)
+	if err := ioutil.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := new(exporter)
+	if err := exp.apply(cfg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-pg.pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a push to the pushgateway")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errC := make(chan error, 1)
+	go func() {
+		errC <- exp.serve(new(http.Server), []net.Listener{l}, time.Second)
+	}()
+
+	// keep the test running if SIGTERM arrives before serve is notified of it, and send it
+	// until serve returns.
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	defer signal.Stop(term)
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for stopped := false; !stopped; {
+		if err := self.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-errC:
+			if err != nil {
+				t.Fatal(err)
+			}
+			stopped = true
+		case <-deadline:
+			t.Fatal("expected serve to return on SIGTERM")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if deletes := pg.deletes(); fmt.Sprint(deletes) != fmt.Sprint(tc.deletes) {
+		t.Errorf("expected deletes %v, got %v", tc.deletes, deletes)
+	}
+}
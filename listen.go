@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"os"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+	"github.com/pkg/errors"
+)
+
+// listen listens on every address configured by cfg. Unix domain sockets are given the
+// configured file mode, and are removed once their listener is closed.
+func listen(cfg *config.Config) ([]net.Listener, error) {
+	mode, err := cfg.Web.FileMode()
+	if err != nil {
+		return nil, err
+	}
+
+	var listeners []net.Listener
+	for _, addr := range cfg.ListenAddresses() {
+		l, err := listenAddress(addr, mode)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Wrapf(err, "listening on %s", addr)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listenAddress(addr string, mode os.FileMode) (net.Listener, error) {
+	network, address, err := config.ParseListenAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+	return listenUnix(address, mode)
+}
+
+// removeStaleSocket removes the socket at path left behind by an exporter which didn't
+// shut down cleanly. Sockets still accepting connections, and other files, are left for
+// listening to fail on.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,25 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// listenUnix listens on a unix domain socket at path, and gives it the given mode. There
+// is no umask to create it with, so it has the default permissions until then.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "setting the mode of %s", path)
+	}
+	return l, nil
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serialises the changes of the process umask made by listenUnix.
+var umaskMu sync.Mutex
+
+// listenUnix listens on a unix domain socket at path, created with the given mode. The
+// umask of the process is set while the socket is created, so that it never has looser
+// permissions than mode.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	umask := syscall.Umask(int(^mode & os.ModePerm))
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
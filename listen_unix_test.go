@@ -0,0 +1,56 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+type listenUnixTestCase struct {
+	name string
+	mode os.FileMode
+}
+
+func TestListenUnix(t *testing.T) {
+	testCases := []listenUnixTestCase{
+		{name: "restrictive", mode: 0600},
+		{name: "looser than the umask", mode: 0666},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc listenUnixTestCase) assert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "exporter.sock")
+
+	umask := syscall.Umask(022)
+	defer syscall.Umask(umask)
+	l, err := listenUnix(path, tc.mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != tc.mode {
+		t.Errorf("expected mode %v, got %v", tc.mode, perm)
+	}
+	if restored := syscall.Umask(022); restored != 022 {
+		t.Errorf("expected the umask to be restored, got %o", restored)
+	}
+}
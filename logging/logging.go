@@ -0,0 +1,283 @@
+// Package logging provides structured, levelled logging, with optional forwarding of
+// errors to reporters such as error tracking services.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// Supported log levels, in increasing order of severity.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return 0, errors.Errorf("unknown log level %q, must be one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Format is the encoding of log entries.
+type Format string
+
+// Supported log formats.
+const (
+	LogfmtFormat Format = "logfmt"
+	JSONFormat   Format = "json"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case LogfmtFormat, JSONFormat:
+		return f, nil
+	}
+	return "", errors.Errorf("unknown log format %q, must be one of %s, %s", name, LogfmtFormat, JSONFormat)
+}
+
+// Fielder is implemented by errors that carry structured fields. When such an error is
+// logged, its fields are added to the log entry.
+type Fielder interface {
+	// LogFields returns alternating keys and values.
+	LogFields() []interface{}
+}
+
+// Logger writes structured log entries at or above its level. Loggers are safe for
+// concurrent use.
+type Logger struct {
+	out       *output
+	level     Level
+	format    Format
+	fields    []interface{}
+	reporters []Reporter
+}
+
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a logger writing entries at or above level to w, in the given format. Errors
+// are also sent to the given reporters.
+func New(w io.Writer, level Level, format Format, reporters ...Reporter) *Logger {
+	return &Logger{
+		out:       &output{w: w},
+		level:     level,
+		format:    format,
+		reporters: reporters,
+	}
+}
+
+// With returns a logger adding the given alternating keys and values to every entry.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	cp := *l
+	cp.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &cp
+}
+
+// Debug logs a message at debug level, with alternating keys and values as fields.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(DebugLevel, msg, nil, keyvals)
+}
+
+// Info logs a message at info level, with alternating keys and values as fields.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(InfoLevel, msg, nil, keyvals)
+}
+
+// Warn logs a message at warn level, with alternating keys and values as fields.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(WarnLevel, msg, nil, keyvals)
+}
+
+// Error logs a message and err at error level, with alternating keys and values as
+// fields, and sends it to the logger's reporters.
+func (l *Logger) Error(msg string, err error, keyvals ...interface{}) {
+	l.log(ErrorLevel, msg, err, keyvals)
+}
+
+// Close closes the logger's reporters, waiting for pending reports to be sent.
+func (l *Logger) Close() error {
+	var err error
+	for _, r := range l.reporters {
+		if rerr := r.Close(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (l *Logger) log(level Level, msg string, err error, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	fields = append(fields, errorFields(err)...)
+	if err != nil {
+		fields = append(fields, "err", err.Error())
+	}
+
+	ev := Event{
+		Time:    time.Now().UTC(),
+		Level:   level,
+		Message: msg,
+		Fields:  fields,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+		ev.Stack = fmt.Sprintf("%+v", err)
+	}
+
+	var buf bytes.Buffer
+	switch l.format {
+	case JSONFormat:
+		ev.writeJSON(&buf)
+	default:
+		ev.writeLogfmt(&buf)
+	}
+	l.out.mu.Lock()
+	l.out.w.Write(buf.Bytes())
+	l.out.mu.Unlock()
+
+	if level >= ErrorLevel {
+		for _, r := range l.reporters {
+			r.Report(ev)
+		}
+	}
+}
+
+// errorFields returns the fields of every Fielder in err's chain of causes.
+func errorFields(err error) []interface{} {
+	var fields []interface{}
+	for err != nil {
+		if f, ok := err.(Fielder); ok {
+			fields = append(fields, f.LogFields()...)
+		}
+		c, ok := err.(interface {
+			Cause() error
+		})
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return fields
+}
+
+// Event is a single log entry.
+type Event struct {
+	Time    time.Time
+	Level   Level
+	Message string
+
+	// Error is the message of the logged error, if any.
+	Error string
+
+	// Stack is the logged error formatted with its stack trace, if it has one.
+	Stack string
+
+	// Fields are alternating keys and values.
+	Fields []interface{}
+}
+
+// FieldMap returns the event's fields as a map.
+func (e Event) FieldMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(e.Fields)/2)
+	for i := 0; i < len(e.Fields); i += 2 {
+		m[fieldKey(e.Fields[i])] = fieldValue(e.Fields, i+1)
+	}
+	return m
+}
+
+func (e Event) writeLogfmt(buf *bytes.Buffer) {
+	buf.WriteString("time=" + e.Time.Format(time.RFC3339))
+	buf.WriteString(" level=" + e.Level.String())
+	buf.WriteString(" msg=" + logfmtValue(e.Message))
+	for i := 0; i < len(e.Fields); i += 2 {
+		buf.WriteString(" " + fieldKey(e.Fields[i]) + "=")
+		buf.WriteString(logfmtValue(fmt.Sprint(fieldValue(e.Fields, i+1))))
+	}
+	buf.WriteByte('\n')
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (e Event) writeJSON(buf *bytes.Buffer) {
+	write := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('{')
+	write("time", e.Time.Format(time.RFC3339))
+	buf.WriteByte(',')
+	write("level", e.Level.String())
+	buf.WriteByte(',')
+	write("msg", e.Message)
+	for i := 0; i < len(e.Fields); i += 2 {
+		buf.WriteByte(',')
+		write(fieldKey(e.Fields[i]), fieldValue(e.Fields, i+1))
+	}
+	buf.WriteString("}\n")
+}
+
+func fieldKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+func fieldValue(fields []interface{}, i int) interface{} {
+	if i >= len(fields) {
+		return "MISSING"
+	}
+	switch v := fields[i].(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
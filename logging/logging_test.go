@@ -0,0 +1,104 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/logging"
+	"github.com/pkg/errors"
+)
+
+func TestLoggerFormats(t *testing.T) {
+	testCases := []formatTestCase{
+		{
+			name:   "logfmt",
+			format: logging.LogfmtFormat,
+			expect: []string{
+				`level=error msg="calling kafka connect API" cluster=a stage=connector_status connector=foo err="getting status: boom"`,
+			},
+		},
+		{
+			name:   "json",
+			format: logging.JSONFormat,
+			expect: []string{
+				`"level":"error","msg":"calling kafka connect API","cluster":"a","stage":"connector_status","connector":"foo","err":"getting status: boom"}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+type formatTestCase struct {
+	name   string
+	format logging.Format
+	expect []string
+}
+
+func (tc formatTestCase) assert(t *testing.T) {
+	var buf bytes.Buffer
+	log := logging.New(&buf, logging.InfoLevel, tc.format).With("cluster", "a")
+
+	err := errors.Wrap(&fieldError{errors.New("boom")}, "getting status")
+	log.Error("calling kafka connect API", err)
+
+	for _, expect := range tc.expect {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("expected %q in output:\n%s", expect, buf.String())
+		}
+	}
+	if tc.format == logging.JSONFormat {
+		var v map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+			t.Errorf("invalid JSON output %q: %s", buf.String(), err)
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log := logging.New(&buf, logging.WarnLevel, logging.LogfmtFormat)
+
+	log.Debug("debug message")
+	log.Info("info message")
+	log.Warn("warn message")
+	log.Error("error message", errors.New("boom"))
+
+	out := buf.String()
+	for _, msg := range []string{"debug message", "info message"} {
+		if strings.Contains(out, msg) {
+			t.Errorf("unexpected %q in output:\n%s", msg, out)
+		}
+	}
+	for _, msg := range []string{"warn message", "error message"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("expected %q in output:\n%s", msg, out)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := logging.ParseLevel("WARN"); err != nil || level != logging.WarnLevel {
+		t.Errorf("expected warn level, got %v, %v", level, err)
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+// fieldError is an error carrying structured fields, like prometheus.UpdateError.
+type fieldError struct {
+	err error
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+
+func (e *fieldError) Cause() error { return e.err }
+
+func (e *fieldError) LogFields() []interface{} {
+	return []interface{}{"stage", "connector_status", "connector", "foo"}
+}
@@ -0,0 +1,206 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultQueueSize is the number of events an HTTPReporter buffers before dropping
+	// new ones.
+	DefaultQueueSize = 100
+
+	rollbarURL          = "https://api.rollbar.com/api/1/item/"
+	logentriesURLPrefix = "https://webhook.logentries.com/noformat/logs/"
+)
+
+// Reporter forwards logged errors, for example to an error tracking service.
+type Reporter interface {
+	// Report sends the event. It must not block the caller.
+	Report(Event)
+
+	// Close stops the reporter, waiting for pending events to be sent.
+	Close() error
+}
+
+// HTTPReporter is a Reporter posting each event to an HTTP endpoint. Events are sent in
+// the background, and dropped if the queue of pending events is full.
+type HTTPReporter struct {
+	// OnError, if set, is called when an event can't be delivered.
+	OnError func(error)
+
+	url    string
+	header http.Header
+	encode func(Event) ([]byte, error)
+	client *http.Client
+	queue  chan Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewHTTPReporter returns a reporter posting events as JSON objects to url. If token is
+// set, it is sent as a bearer token.
+func NewHTTPReporter(url, token string) *HTTPReporter {
+	header := make(http.Header)
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return newHTTPReporter(url, header, encodeJSON)
+}
+
+// NewRollbarReporter returns a reporter sending events to rollbar, using the given access
+// token and environment.
+func NewRollbarReporter(token, env string) *HTTPReporter {
+	header := make(http.Header)
+	header.Set("X-Rollbar-Access-Token", token)
+	return newHTTPReporter(rollbarURL, header, func(e Event) ([]byte, error) {
+		return encodeRollbar(e, env)
+	})
+}
+
+// NewLogentriesReporter returns a reporter sending events to the logentries log with the
+// given token.
+func NewLogentriesReporter(token string) *HTTPReporter {
+	return newHTTPReporter(logentriesURLPrefix+token, make(http.Header), encodeJSON)
+}
+
+func newHTTPReporter(url string, header http.Header, encode func(Event) ([]byte, error)) *HTTPReporter {
+	header.Set("Content-Type", "application/json")
+	r := &HTTPReporter{
+		url:    url,
+		header: header,
+		encode: encode,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Event, DefaultQueueSize),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Report queues the event to be sent. If the queue is full, or the reporter is closed, the
+// event is dropped.
+func (r *HTTPReporter) Report(e Event) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- e:
+	default:
+		r.fail(errors.Errorf("report queue full, dropping event %q", e.Message))
+	}
+}
+
+// Close stops accepting events, and waits for queued events to be sent.
+func (r *HTTPReporter) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+	return nil
+}
+
+func (r *HTTPReporter) run() {
+	defer close(r.done)
+	for e := range r.queue {
+		if err := r.send(e); err != nil {
+			r.fail(errors.Wrapf(err, "reporting event to %s", r.url))
+		}
+	}
+}
+
+func (r *HTTPReporter) send(e Event) error {
+	body, err := r.encode(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (r *HTTPReporter) fail(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+func encodeJSON(e Event) ([]byte, error) {
+	return json.Marshal(struct {
+		Time    time.Time              `json:"time"`
+		Level   string                 `json:"level"`
+		Message string                 `json:"msg"`
+		Error   string                 `json:"error,omitempty"`
+		Stack   string                 `json:"stack,omitempty"`
+		Fields  map[string]interface{} `json:"fields,omitempty"`
+	}{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+		Error:   e.Error,
+		Stack:   e.Stack,
+		Fields:  e.FieldMap(),
+	})
+}
+
+func encodeRollbar(e Event, env string) ([]byte, error) {
+	body := e.Message
+	if e.Stack != "" {
+		body += ": " + e.Stack
+	}
+	level := e.Level.String()
+	if e.Level == WarnLevel {
+		level = "warning"
+	}
+
+	type message struct {
+		Body string `json:"body"`
+	}
+	type data struct {
+		Environment string                 `json:"environment"`
+		Level       string                 `json:"level"`
+		Timestamp   int64                  `json:"timestamp"`
+		Platform    string                 `json:"platform"`
+		Language    string                 `json:"language"`
+		Body        map[string]message     `json:"body"`
+		Custom      map[string]interface{} `json:"custom,omitempty"`
+	}
+	return json.Marshal(struct {
+		Data data `json:"data"`
+	}{
+		Data: data{
+			Environment: env,
+			Level:       level,
+			Timestamp:   e.Time.Unix(),
+			Platform:    "linux",
+			Language:    "go",
+			Body:        map[string]message{"message": {Body: body}},
+			Custom:      e.FieldMap(),
+		},
+	})
+}
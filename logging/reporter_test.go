@@ -0,0 +1,97 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/autotraderuk/kafka-connect-exporter/logging"
+	"github.com/pkg/errors"
+)
+
+func TestHTTPReporter(t *testing.T) {
+	sink := new(mockErrorSink)
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	reporter := logging.NewHTTPReporter(srv.URL, "secret")
+	log := logging.New(ioutil.Discard, logging.InfoLevel, logging.LogfmtFormat, reporter)
+
+	log.Info("not reported")
+	log.Error("calling kafka connect API", errors.New("boom"), "cluster", "a")
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// events after closing are dropped rather than panicking
+	log.Error("dropped", errors.New("boom"))
+
+	events := sink.received()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Message != "calling kafka connect API" || ev.Error != "boom" || ev.Level != "error" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev.Fields["cluster"] != "a" {
+		t.Errorf("expected cluster field, got %v", ev.Fields)
+	}
+	if sink.authorization != "Bearer secret" {
+		t.Errorf("unexpected authorization header %q", sink.authorization)
+	}
+}
+
+func TestHTTPReporterOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var failures []error
+	reporter := logging.NewHTTPReporter(srv.URL, "")
+	reporter.OnError = func(err error) {
+		failures = append(failures, err)
+	}
+	reporter.Report(logging.Event{Message: "boom"})
+	reporter.Close()
+
+	if len(failures) != 1 {
+		t.Errorf("expected 1 failure, got %v", failures)
+	}
+}
+
+type reportedEvent struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"msg"`
+	Error   string                 `json:"error"`
+	Stack   string                 `json:"stack"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+// mockErrorSink is a stand-in for an error tracking service.
+type mockErrorSink struct {
+	mu            sync.Mutex
+	events        []reportedEvent
+	authorization string
+}
+
+func (s *mockErrorSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var ev reportedEvent
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+	s.authorization = r.Header.Get("Authorization")
+}
+
+func (s *mockErrorSink) received() []reportedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
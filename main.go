@@ -2,40 +2,66 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
-	"github.com/caarlos0/env"
-	"github.com/go-kafka/connect"
-	"github.com/pkg/errors"
-	prom "github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/config"
 )
 
-type config struct {
-	KafkaConnectHost string `env:"KAFKA_CONNECT_HOST"`
-	Port             int    `env:"PORT" envDefault:"9400"`
+// version is the version of the exporter, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
+
+// loaderFlags registers the --config flag and the config flags with fs, and returns the
+// loader they set once fs is parsed.
+func loaderFlags(fs *flag.FlagSet) *config.Loader {
+	loader := &config.Loader{Flags: config.NewFlags(fs)}
+	fs.StringVar(&loader.Path, "config", "", "path to a YAML config file")
+	return loader
 }
 
-func graceful(srv *http.Server, timeout time.Duration) error {
-	stop := make(chan os.Signal)
-	signal.Notify(stop, os.Interrupt, os.Kill)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, `Usage:
+  kafka-connect-exporter [flags]         serve the metrics of kafka connect
+  kafka-connect-exporter check [flags]   check the connectors as a Nagios plugin
+  kafka-connect-exporter status [flags]  print the connectors
+  kafka-connect-exporter top [flags]     show the connectors interactively
 
-	errC := make(chan error)
-	go func() {
-		defer close(errC)
-		if err := srv.ListenAndServe(); err != nil {
-			errC <- err
-		}
-	}()
+Settings are taken from, in increasing order of precedence: defaults, consul, the
+config file, environment variables and flags.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// graceful serves srv on the listeners until serving fails, or the process is interrupted
+// or terminated, as docker and kubernetes stop containers, in which case srv is shut down
+// within timeout.
+func graceful(srv *http.Server, listeners []net.Listener, timeout time.Duration) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	errC := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errC <- srv.Serve(l)
+		}(l)
+	}
 
 	select {
 	case err := <-errC:
+		srv.Close()
 		return err
 	case <-stop:
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -45,29 +71,59 @@ func graceful(srv *http.Server, timeout time.Duration) error {
 }
 
 func main() {
-	cfg := new(config)
-	if err := env.Parse(cfg); err != nil {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "top":
+			os.Exit(runTop(os.Args[2:]))
+		}
+	}
+
+	loader := loaderFlags(flag.CommandLine)
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = usage
+	flag.Parse()
+	if *showVersion {
+		fmt.Println("kafka-connect-exporter", version)
+		return
+	}
+
+	cfg, err := loader.Load(context.Background())
+	if err != nil {
 		log.Fatal(err)
 	}
 
 	// set up connect api refresh
-	client := connect.NewClient(cfg.KafkaConnectHost)
-	metrics := prometheus.NewMetrics(client)
-	prom.MustRegister(metrics)
+	exp := new(exporter)
+	if err := exp.apply(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	// reload config on SIGHUP, and when the config file or remote config changes
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reload := &reloader{loader: loader, exp: exp}
+	reload.record(nil)
+	go reload.watch(ctx)
 
 	// expose metrics via http
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if err := metrics.Update(); err != nil {
-			log.Print(errors.WithStack(errors.WithMessage(err, "calling kafka connect API")))
-			//w.WriteHeader(500)
-			//w.Write([]byte(errors.Cause(err).Error()))
-			return
-		}
-		promhttp.Handler().ServeHTTP(w, r)
-	})
-	timeout := 10 * time.Second
-	if err := graceful(&http.Server{Addr: addr, Handler: handler}, timeout); err != nil {
+	listeners, err := listen(cfg)
+	if err != nil {
 		log.Fatal(err)
 	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	mux.HandleFunc("/-/healthy", exp.serveHealthy)
+	mux.HandleFunc("/-/ready", exp.serveReady)
+	mux.Handle(api.Prefix, api.NewHandler(exp))
+	mux.HandleFunc("/config", exp.serveConfig)
+	mux.Handle("/-/reload", reload)
+	mux.HandleFunc("/", exp.serveStatus)
+	timeout := 10 * time.Second
+	if err := exp.serve(&http.Server{Handler: mux}, listeners, timeout); err != nil {
+		os.Exit(1)
+	}
 }
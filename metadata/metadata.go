@@ -0,0 +1,251 @@
+// Package metadata provides a catalog of connector metadata, such as owners and runbooks,
+// maintained outside of kafka connect.
+//
+// A catalog is a list of entries, each matching connector names against a regular
+// expression. It is read from a YAML file, or from a CSV file if the file name ends in
+// .csv. YAML catalogs have the following form:
+//
+//	connectors:
+//	  - pattern: "^orders-"
+//	    owner: team-orders
+//	    tier: gold
+//	    runbook-url: https://runbooks.example.com/orders
+//	    slack-channel: "#orders-oncall"
+//
+// CSV catalogs must have a header row naming the columns, using the same names as the
+// YAML keys.
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Metadata describes a connector.
+type Metadata struct {
+	Owner        string `yaml:"owner" json:"owner,omitempty"`
+	Tier         string `yaml:"tier" json:"tier,omitempty"`
+	RunbookURL   string `yaml:"runbook-url" json:"runbook_url,omitempty"`
+	SlackChannel string `yaml:"slack-channel" json:"slack_channel,omitempty"`
+}
+
+// LogFields returns the non-empty metadata as structured log fields.
+func (m Metadata) LogFields() []interface{} {
+	var fields []interface{}
+	for _, f := range []struct{ key, value string }{
+		{"owner", m.Owner},
+		{"tier", m.Tier},
+		{"runbook_url", m.RunbookURL},
+		{"slack_channel", m.SlackChannel},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.key, f.value)
+		}
+	}
+	return fields
+}
+
+// Entry is the metadata for connectors with names matching Pattern.
+type Entry struct {
+	Pattern  string `yaml:"pattern"`
+	Metadata `yaml:",inline"`
+
+	re *regexp.Regexp
+}
+
+// Catalog is a list of entries. The first entry matching a connector's name is used.
+type Catalog struct {
+	Entries []Entry `yaml:"connectors"`
+}
+
+// Lookup returns the metadata of the first entry matching the connector, and whether
+// there was one. It is safe to call on a nil catalog.
+func (c *Catalog) Lookup(connector string) (Metadata, bool) {
+	if c == nil {
+		return Metadata{}, false
+	}
+	for _, e := range c.Entries {
+		if e.re.MatchString(connector) {
+			return e.Metadata, true
+		}
+	}
+	return Metadata{}, false
+}
+
+// ParseYAML returns the catalog in the given YAML document.
+func ParseYAML(data []byte) (*Catalog, error) {
+	c := new(Catalog)
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, err
+	}
+	return c, c.compile()
+}
+
+// ParseCSV returns the catalog in the given CSV document.
+func ParseCSV(data []byte) (*Catalog, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return new(Catalog), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if _, err := new(Entry).field(header[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	c := new(Catalog)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e Entry
+		for i, column := range header {
+			field, _ := e.field(column)
+			*field = record[i]
+		}
+		c.Entries = append(c.Entries, e)
+	}
+	return c, c.compile()
+}
+
+func (e *Entry) field(name string) (*string, error) {
+	switch name {
+	case "pattern":
+		return &e.Pattern, nil
+	case "owner":
+		return &e.Owner, nil
+	case "tier":
+		return &e.Tier, nil
+	case "runbook-url":
+		return &e.RunbookURL, nil
+	case "slack-channel":
+		return &e.SlackChannel, nil
+	}
+	return nil, errors.Errorf("unknown column %q", name)
+}
+
+func (c *Catalog) compile() error {
+	for i := range c.Entries {
+		e := &c.Entries[i]
+		if e.Pattern == "" {
+			return errors.Errorf("entry %d: pattern must be set", i)
+		}
+		re, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "entry %d", i)
+		}
+		e.re = re
+	}
+	return nil
+}
+
+// Load returns the catalog in the file at path.
+func Load(path string) (*Catalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, data)
+}
+
+func parse(path string, data []byte) (*Catalog, error) {
+	var (
+		c   *Catalog
+		err error
+	)
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		c, err = ParseCSV(data)
+	} else {
+		c, err = ParseYAML(data)
+	}
+	return c, errors.Wrapf(err, "parsing metadata catalog %s", path)
+}
+
+// Source provides the contents of a catalog file, such as a config.FileSource.
+type Source interface {
+	// Read returns the current contents of the file.
+	Read(ctx context.Context) ([]byte, error)
+
+	// Watch blocks until the contents of the file change, and returns them.
+	Watch(ctx context.Context) ([]byte, error)
+}
+
+// Store holds the catalog in a file, and keeps it up to date as the file changes.
+type Store struct {
+	src  Source
+	path string
+
+	mu      sync.RWMutex
+	catalog *Catalog
+}
+
+// NewStore returns a store holding the catalog read from src. The path of the file is used
+// to decide its format.
+func NewStore(path string, src Source) (*Store, error) {
+	s := &Store{
+		src:  src,
+		path: path,
+	}
+	data, err := s.src.Read(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "reading metadata catalog")
+	}
+	if s.catalog, err = parse(path, data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lookup returns the metadata of the first entry in the current catalog matching the
+// connector, and whether there was one. It is safe to call on a nil store.
+func (s *Store) Lookup(connector string) (Metadata, bool) {
+	if s == nil {
+		return Metadata{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.catalog.Lookup(connector)
+}
+
+// Watch reloads the catalog each time the file changes, until ctx is done. If the file
+// can't be read or parsed, onError is called, and the current catalog is kept.
+func (s *Store) Watch(ctx context.Context, onError func(error)) {
+	for {
+		data, err := s.src.Watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		var c *Catalog
+		if err == nil {
+			c, err = parse(s.path, data)
+		}
+		if err != nil {
+			onError(err)
+			continue
+		}
+		s.mu.Lock()
+		s.catalog = c
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,150 @@
+package metadata_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
+)
+
+type lookupTestCase struct {
+	name      string
+	connector string
+	expect    metadata.Metadata
+	expectOK  bool
+}
+
+func TestParse(t *testing.T) {
+	yamlCatalog, err := metadata.ParseYAML([]byte(`
+connectors:
+  - pattern: "^orders-"
+    owner: team-orders
+    tier: gold
+    runbook-url: https://runbooks.example.com/orders
+    slack-channel: "#orders-oncall"
+  - pattern: "-sink$"
+    owner: team-sinks
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvCatalog, err := metadata.ParseCSV([]byte(`pattern, owner, tier, runbook-url, slack-channel
+^orders-, team-orders, gold, https://runbooks.example.com/orders, #orders-oncall
+-sink$, team-sinks, , ,
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []lookupTestCase{
+		{
+			name:      "first match",
+			connector: "orders-sink",
+			expect: metadata.Metadata{
+				Owner:        "team-orders",
+				Tier:         "gold",
+				RunbookURL:   "https://runbooks.example.com/orders",
+				SlackChannel: "#orders-oncall",
+			},
+			expectOK: true,
+		},
+		{
+			name:      "later match",
+			connector: "users-sink",
+			expect:    metadata.Metadata{Owner: "team-sinks"},
+			expectOK:  true,
+		},
+		{
+			name:      "no match",
+			connector: "users-source",
+		},
+	}
+	for name, catalog := range map[string]*metadata.Catalog{"yaml": yamlCatalog, "csv": csvCatalog} {
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.name, func(t *testing.T) {
+				md, ok := catalog.Lookup(tc.connector)
+				if ok != tc.expectOK || md != tc.expect {
+					t.Errorf("expected %+v, %v, got %+v, %v", tc.expect, tc.expectOK, md, ok)
+				}
+			})
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, parse := range map[string]func() (*metadata.Catalog, error){
+		"missing pattern": func() (*metadata.Catalog, error) {
+			return metadata.ParseYAML([]byte("connectors:\n  - owner: team-orders\n"))
+		},
+		"invalid pattern": func() (*metadata.Catalog, error) {
+			return metadata.ParseYAML([]byte("connectors:\n  - pattern: \"(\"\n"))
+		},
+		"unknown key": func() (*metadata.Catalog, error) {
+			return metadata.ParseYAML([]byte("connectors:\n  - pattern: a\n    team: b\n"))
+		},
+		"unknown column": func() (*metadata.Catalog, error) {
+			return metadata.ParseCSV([]byte("pattern,team\na,b\n"))
+		},
+	} {
+		if _, err := parse(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.csv")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("pattern,owner\norders,team-orders\n")
+
+	src := config.NewFileSource(path)
+	src.PollInterval = 10 * time.Millisecond
+	store, err := metadata.NewStore(path, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md, _ := store.Lookup("orders"); md.Owner != "team-orders" {
+		t.Fatalf("expected owner team-orders, got %q", md.Owner)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 10)
+	go store.Watch(ctx, func(err error) { errs <- err })
+
+	write("pattern,team\n")
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("expected an error for an invalid catalog")
+	}
+	if md, _ := store.Lookup("orders"); md.Owner != "team-orders" {
+		t.Fatalf("expected the current catalog to be kept, got owner %q", md.Owner)
+	}
+
+	write("pattern,owner\norders,team-platform\n")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if md, _ := store.Lookup("orders"); md.Owner == "team-platform" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("catalog was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,180 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Field numbers of the OTLP messages encoded, from opentelemetry/proto/metrics/v1,
+// common/v1 and resource/v1.
+const (
+	requestResourceMetrics = 1
+
+	resourceMetricsResource     = 1
+	resourceMetricsScopeMetrics = 2
+
+	resourceAttributes = 1
+
+	keyValueKey         = 1
+	keyValueValue       = 2
+	anyValueStringValue = 1
+
+	scopeMetricsScope   = 1
+	scopeMetricsMetrics = 2
+	scopeName           = 1
+
+	metricName        = 1
+	metricDescription = 2
+	metricGauge       = 5
+	metricSum         = 7
+
+	gaugeDataPoints           = 1
+	sumDataPoints             = 1
+	sumAggregationTemporality = 2
+	sumIsMonotonic            = 3
+
+	dataPointStartTime  = 2
+	dataPointTime       = 3
+	dataPointAsDouble   = 4
+	dataPointAttributes = 7
+
+	// temporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+	temporalityCumulative = 2
+)
+
+// wire types of protobuf fields.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// message is an encoded protobuf message, to which fields are appended.
+type message []byte
+
+func (m *message) tag(field, wire int) {
+	m.uvarint(uint64(field)<<3 | uint64(wire))
+}
+
+func (m *message) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	*m = append(*m, buf[:n]...)
+}
+
+func (m *message) varint(field int, v uint64) {
+	m.tag(field, wireVarint)
+	m.uvarint(v)
+}
+
+func (m *message) fixed64(field int, v uint64) {
+	m.tag(field, wireFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	*m = append(*m, buf[:]...)
+}
+
+func (m *message) double(field int, v float64) {
+	m.fixed64(field, math.Float64bits(v))
+}
+
+func (m *message) bytes(field int, b []byte) {
+	m.tag(field, wireBytes)
+	m.uvarint(uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *message) string(field int, s string) {
+	if s != "" {
+		m.bytes(field, []byte(s))
+	}
+}
+
+func (m *message) attribute(field int, key, value string) {
+	var v, kv message
+	v.string(anyValueStringValue, value)
+	kv.string(keyValueKey, key)
+	kv.bytes(keyValueValue, v)
+	m.bytes(field, kv)
+}
+
+// encodeRequest returns an ExportMetricsServiceRequest of the metric families, with a
+// single resource. Gauges and untyped metrics are exported as gauges, and counters as
+// cumulative sums, which started at start. Other types are skipped.
+func encodeRequest(resource map[string]string, mfs []*dto.MetricFamily, start, now time.Time) []byte {
+	var res message
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		res.attribute(resourceAttributes, k, resource[k])
+	}
+
+	var scope, scopeMetrics message
+	scope.string(scopeName, Scope)
+	scopeMetrics.bytes(scopeMetricsScope, scope)
+	for _, mf := range mfs {
+		if metric := encodeMetric(mf, start, now); metric != nil {
+			scopeMetrics.bytes(scopeMetricsMetrics, metric)
+		}
+	}
+
+	var rm, req message
+	rm.bytes(resourceMetricsResource, res)
+	rm.bytes(resourceMetricsScopeMetrics, scopeMetrics)
+	req.bytes(requestResourceMetrics, rm)
+	return req
+}
+
+func encodeMetric(mf *dto.MetricFamily, start, now time.Time) message {
+	var data message
+	var field int
+	switch mf.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		field = metricGauge
+		for _, m := range mf.GetMetric() {
+			v := m.GetGauge().GetValue()
+			if mf.GetType() == dto.MetricType_UNTYPED {
+				v = m.GetUntyped().GetValue()
+			}
+			data.bytes(gaugeDataPoints, encodeDataPoint(m, v, time.Time{}, now))
+		}
+	case dto.MetricType_COUNTER:
+		field = metricSum
+		for _, m := range mf.GetMetric() {
+			data.bytes(sumDataPoints, encodeDataPoint(m, m.GetCounter().GetValue(), start, now))
+		}
+		data.varint(sumAggregationTemporality, temporalityCumulative)
+		data.varint(sumIsMonotonic, 1)
+	default:
+		return nil
+	}
+
+	var metric message
+	metric.string(metricName, mf.GetName())
+	metric.string(metricDescription, mf.GetHelp())
+	metric.bytes(field, data)
+	return metric
+}
+
+func encodeDataPoint(m *dto.Metric, v float64, start, now time.Time) message {
+	if m.TimestampMs != nil {
+		now = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+	}
+	var dp message
+	if !start.IsZero() {
+		dp.fixed64(dataPointStartTime, uint64(start.UnixNano()))
+	}
+	dp.fixed64(dataPointTime, uint64(now.UnixNano()))
+	dp.double(dataPointAsDouble, v)
+	for _, l := range m.GetLabel() {
+		dp.attribute(dataPointAttributes, l.GetName(), l.GetValue())
+	}
+	return dp
+}
@@ -0,0 +1,168 @@
+// Package otlp exports metrics gathered from prometheus collectors to an OTLP receiver,
+// such as an OpenTelemetry collector, over gRPC or HTTP.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http2"
+)
+
+// Scope is the name of the instrumentation scope of the metrics exported.
+const Scope = "github.com/autotraderuk/kafka-connect-exporter"
+
+// Protocol is the transport of an Exporter.
+type Protocol string
+
+// Protocols, named as by OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	GRPC Protocol = "grpc"
+	HTTP Protocol = "http/protobuf"
+)
+
+// ParseProtocol returns the protocol of the given name.
+func ParseProtocol(name string) (Protocol, error) {
+	switch p := Protocol(strings.ToLower(name)); p {
+	case GRPC, HTTP:
+		return p, nil
+	}
+	return "", errors.Errorf("unknown protocol %q, expected grpc or http/protobuf", name)
+}
+
+// Paths of the OTLP metrics export endpoints.
+const (
+	grpcPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	httpPath = "/v1/metrics"
+)
+
+// Exporter exports metrics to an OTLP receiver. Each export is a single request, which
+// isn't retried: metrics are exported again on the next poll.
+type Exporter struct {
+	endpoint string
+	protocol Protocol
+	client   *http.Client
+
+	// Headers are sent with every request, such as authorization headers.
+	Headers map[string]string
+
+	// Start is the time the counters exported started counting from.
+	Start time.Time
+}
+
+// NewExporter returns an exporter to the receiver at endpoint, the base URL of the
+// receiver, such as http://collector:4317 for gRPC, or http://collector:4318 for HTTP.
+// gRPC is sent over HTTP/2, with TLS for https endpoints, and without for http ones.
+func NewExporter(endpoint string, protocol Protocol, timeout time.Duration) *Exporter {
+	client := &http.Client{Timeout: timeout}
+	if protocol == GRPC {
+		client.Transport = newHTTP2Transport(endpoint)
+	}
+	return &Exporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		protocol: protocol,
+		client:   client,
+		Start:    time.Now(),
+	}
+}
+
+// newHTTP2Transport returns a transport which only speaks HTTP/2. For http endpoints it
+// dials plain TCP connections, and uses HTTP/2 without TLS, as gRPC receivers expect.
+func newHTTP2Transport(endpoint string) http.RoundTripper {
+	t := new(http2.Transport)
+	if strings.HasPrefix(strings.ToLower(endpoint), "http://") {
+		t.AllowHTTP = true
+		t.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+	return t
+}
+
+// Export exports the metrics gathered from g, as the metrics of a resource with the given
+// attributes.
+func (e *Exporter) Export(ctx context.Context, resource map[string]string, g prom.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return errors.Wrap(err, "gathering metrics")
+	}
+	body := encodeRequest(resource, mfs, e.Start, time.Now())
+	if e.protocol == GRPC {
+		return e.exportGRPC(ctx, body)
+	}
+	return e.exportHTTP(ctx, body)
+}
+
+func (e *Exporter) exportHTTP(ctx context.Context, body []byte) error {
+	req, err := e.newRequest(ctx, e.endpoint+httpPath, "application/x-protobuf", body)
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.Errorf("exporting to %s: unexpected status %d: %s", req.URL, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// exportGRPC sends the request as a single gRPC message: a byte flagging it as
+// uncompressed, and its length.
+func (e *Exporter) exportGRPC(ctx context.Context, msg []byte) error {
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	req, err := e.newRequest(ctx, e.endpoint+grpcPath, "application/grpc", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("TE", "trailers")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("exporting to %s: unexpected status %d", req.URL, res.StatusCode)
+	}
+	// the status is in the trailers, once the body is read, or in the headers of responses
+	// without a body.
+	io.Copy(ioutil.Discard, res.Body)
+	status, msgText := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msgText = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return errors.Errorf("exporting to %s: grpc status %s: %s", req.URL, status, msgText)
+	}
+	return nil
+}
+
+func (e *Exporter) newRequest(ctx context.Context, url, contentType string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
@@ -0,0 +1,219 @@
+package otlp_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/otlp"
+	prom "github.com/prometheus/client_golang/prometheus"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+)
+
+// point is a decoded number data point.
+type point struct {
+	attrs   map[string]string
+	value   float64
+	started bool
+}
+
+// export is a decoded ExportMetricsServiceRequest, with a single resource.
+type export struct {
+	resource map[string]string
+	gauges   map[string][]point
+	sums     map[string][]point
+}
+
+// attributes returns the string values of the attributes.
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range kvs {
+		attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return attrs
+}
+
+func points(dps []*metricspb.NumberDataPoint) []point {
+	var ps []point
+	for _, dp := range dps {
+		ps = append(ps, point{
+			attrs:   attributes(dp.GetAttributes()),
+			value:   dp.GetAsDouble(),
+			started: dp.GetStartTimeUnixNano() != 0,
+		})
+	}
+	return ps
+}
+
+// decodeExport decodes the body of an export request with the generated OTLP types.
+// MetricsData has the same fields as ExportMetricsServiceRequest, without depending on
+// grpc.
+func decodeExport(body []byte) (export, error) {
+	var data metricspb.MetricsData
+	if err := proto.Unmarshal(body, &data); err != nil {
+		return export{}, err
+	}
+	if n := len(data.GetResourceMetrics()); n != 1 {
+		return export{}, fmt.Errorf("expected a single resource, got %d", n)
+	}
+	rm := data.GetResourceMetrics()[0]
+	exp := export{
+		resource: attributes(rm.GetResource().GetAttributes()),
+		gauges:   make(map[string][]point),
+		sums:     make(map[string][]point),
+	}
+	for _, sm := range rm.GetScopeMetrics() {
+		if sm.GetScope().GetName() != otlp.Scope {
+			return export{}, fmt.Errorf("unexpected scope %q", sm.GetScope().GetName())
+		}
+		for _, m := range sm.GetMetrics() {
+			switch data := m.GetData().(type) {
+			case *metricspb.Metric_Gauge:
+				exp.gauges[m.GetName()] = points(data.Gauge.GetDataPoints())
+			case *metricspb.Metric_Sum:
+				if !data.Sum.GetIsMonotonic() || data.Sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+					return export{}, fmt.Errorf("expected %s to be a cumulative monotonic sum", m.GetName())
+				}
+				exp.sums[m.GetName()] = points(data.Sum.GetDataPoints())
+			default:
+				return export{}, fmt.Errorf("unexpected data %T of %s", data, m.GetName())
+			}
+		}
+	}
+	return exp, nil
+}
+
+// receiver is an in-process OTLP receiver, accepting exports over gRPC and HTTP.
+type receiver struct {
+	mu      sync.Mutex
+	exports []export
+	headers []http.Header
+
+	// grpcStatus is the status of gRPC responses.
+	grpcStatus string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	switch r.URL.Path {
+	case "/v1/metrics":
+	case "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export":
+		if r.ProtoMajor != 2 || len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			http.Error(w, "invalid grpc request", http.StatusBadRequest)
+			return
+		}
+		body = body[5:]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	exp, err := decodeExport(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	rc.exports = append(rc.exports, exp)
+	rc.headers = append(rc.headers, r.Header)
+	rc.mu.Unlock()
+
+	if r.URL.Path == "/v1/metrics" {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.Write([]byte{0, 0, 0, 0, 0})
+	status := rc.grpcStatus
+	if status == "" {
+		status = "0"
+	}
+	w.Header().Set("Grpc-Status", status)
+	if status != "0" {
+		w.Header().Set("Grpc-Message", "rejected")
+	}
+}
+
+func newReceiver(rc *receiver) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(rc, new(http2.Server)))
+}
+
+func registry() *prom.Registry {
+	reg := prom.NewRegistry()
+	tasks := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_tasks", Help: "tasks"}, []string{"connector", "state"})
+	tasks.WithLabelValues("orders", "RUNNING").Set(2)
+	retries := prom.NewCounter(prom.CounterOpts{Name: "kafka_connect_exporter_api_retries_total", Help: "retries"})
+	retries.Add(3)
+	reg.MustRegister(tasks, retries)
+	return reg
+}
+
+type exportTestCase struct {
+	name       string
+	protocol   otlp.Protocol
+	grpcStatus string
+	err        bool
+}
+
+func TestExporterExport(t *testing.T) {
+	testCases := []exportTestCase{
+		{name: "grpc", protocol: otlp.GRPC},
+		{name: "http", protocol: otlp.HTTP},
+		{name: "grpc error status", protocol: otlp.GRPC, grpcStatus: "3", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc exportTestCase) assert(t *testing.T) {
+	rc := &receiver{grpcStatus: tc.grpcStatus}
+	srv := newReceiver(rc)
+	defer srv.Close()
+
+	e := otlp.NewExporter(srv.URL, tc.protocol, 5*time.Second)
+	e.Headers = map[string]string{"Authorization": "Bearer token"}
+	resource := map[string]string{"service.name": "kafka-connect-exporter", "kafka.connect.cluster.name": "prod"}
+	err := e.Export(context.Background(), resource, registry())
+	if tc.err {
+		if err == nil {
+			t.Error("expected an error")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.exports) != 1 {
+		t.Fatalf("expected a single export, got %d", len(rc.exports))
+	}
+	exp := rc.exports[0]
+	if auth := rc.headers[0].Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("expected the configured headers, got authorization %q", auth)
+	}
+	if !reflect.DeepEqual(exp.resource, resource) {
+		t.Errorf("expected resource %v, got %v", resource, exp.resource)
+	}
+	expectGauge := []point{{attrs: map[string]string{"connector": "orders", "state": "RUNNING"}, value: 2}}
+	if got := exp.gauges["kafka_connect_tasks"]; !reflect.DeepEqual(got, expectGauge) {
+		t.Errorf("expected gauge %+v, got %+v", expectGauge, got)
+	}
+	expectSum := []point{{attrs: map[string]string{}, value: 3, started: true}}
+	if got := exp.sums["kafka_connect_exporter_api_retries_total"]; !reflect.DeepEqual(got, expectSum) {
+		t.Errorf("expected cumulative sum %+v, got %+v", expectSum, got)
+	}
+}
@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WithConstLabels returns a gatherer attaching the given labels to every metric gathered
+// by g, such as the default registry's process and go metrics. Metrics which already have
+// a label of the same name keep their own value.
+func WithConstLabels(g prom.Gatherer, labels map[string]string) prom.Gatherer {
+	if len(labels) == 0 {
+		return g
+	}
+	return constLabelGatherer{g, labels}
+}
+
+type constLabelGatherer struct {
+	prom.Gatherer
+	labels map[string]string
+}
+
+func (g constLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, f := range families {
+		for _, m := range f.Metric {
+			m.Label = withLabels(m.Label, g.labels)
+		}
+	}
+	return families, err
+}
+
+// withLabels returns pairs with the labels added, sorted by name.
+func withLabels(pairs []*dto.LabelPair, labels map[string]string) []*dto.LabelPair {
+	have := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		have[p.GetName()] = true
+	}
+	for name, value := range labels {
+		if !have[name] {
+			pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].GetName() < pairs[j].GetName() })
+	return pairs
+}
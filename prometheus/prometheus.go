@@ -2,94 +2,812 @@
 package prometheus
 
 import (
-	"net/http"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
-	"github.com/go-kafka/connect"
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
 	"github.com/pkg/errors"
 	prom "github.com/prometheus/client_golang/prometheus"
 )
 
+// Default metric name prefixes.
+const (
+	DefaultNamespace = "kafka"
+	DefaultSubsystem = "connect"
+)
+
+// Names of the labels the exporter attaches to its metrics, which can be changed with
+// Opts.LabelNames.
+const (
+	LabelCluster      = "cluster"
+	LabelConnector    = "connector"
+	LabelState        = "state"
+	LabelWorker       = "worker"
+	LabelOwner        = "owner"
+	LabelTier         = "tier"
+	LabelRunbookURL   = "runbook_url"
+	LabelSlackChannel = "slack_channel"
+	LabelReason       = "reason"
+)
+
+// familyLabels lists the labels of each metric family, other than those derived from
+// connector names and configs.
+var familyLabels = map[string][]string{
+	"tasks":                   {LabelCluster, LabelConnector, LabelState, LabelWorker},
+	"connector_metadata_info": {LabelCluster, LabelConnector, LabelOwner, LabelTier, LabelRunbookURL, LabelSlackChannel},
+	"series_dropped_total":    {LabelCluster, LabelReason},
+	"snapshot_age_seconds":    {LabelCluster},
+	"api_retries_total":       {LabelCluster, LabelReason},
+	"scrape_truncated":        {LabelCluster},
+}
+
+var (
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+)
+
 // Metrics encapsulates prom metrics for kafka connect tasks.
 type Metrics struct {
 	*prom.GaugeVec
-	client ConnectClient
+	info         *prom.GaugeVec
+	labelNames   map[string]string
+	metadata     MetadataLookup
+	client       ConnectClient
+	pollInterval time.Duration
+	include      []*regexp.Regexp
+	exclude      []*regexp.Regexp
+	namePattern  *regexp.Regexp
+	configLabels []string
+	maxLabelLen  int
+	maxConns     int
+	maxSeries    int
+	dropped      *prom.CounterVec
+	retries      *prom.CounterVec
+	otherLabels  prom.Labels
+
+	// droppedConns are the connectors the last update aggregated into OtherConnector,
+	// whose series aren't counted as dropped again. It is guarded by snapMu.
+	droppedConns map[string]bool
+
+	// refreshing holds a token while a refresh is in progress, so that refreshes waiting
+	// for it can give up when their context is done.
+	refreshing chan struct{}
+	lastUpdate time.Time
+
+	// snapMu guards the snapshot while it is replaced by an update.
+	snapMu     sync.RWMutex
+	snapshotAt time.Time
+	failing    bool
+	partial    bool
+	truncated  prom.Gauge
+	maxAge     time.Duration
+	ageDesc    *prom.Desc
+
+	// connectors and transitions are the state of the connectors in the snapshot, and when
+	// each connector and task was first seen in it.
+	connectors  []ConnectorSnapshot
+	transitions map[string]transition
 }
 
-// ConnectClient is an abstraction for a kafka connect REST Client.
-//
-// NOTE: This may change, since it is currently designed around the go-kafka/connect package.
+// Opts configures the metrics returned by NewMetricsWithOpts.
+type Opts struct {
+	// Cluster, if set, is attached to every metric as the "cluster" label.
+	Cluster string
+
+	// Namespace and Subsystem prefix the names of every metric. They default to
+	// DefaultNamespace and DefaultSubsystem.
+	Namespace string
+	Subsystem string
+
+	// ConstLabels are attached to every metric.
+	ConstLabels map[string]string
+
+	// LabelNames renames the exporter's labels, such as LabelConnector, which are the
+	// keys of the map.
+	LabelNames map[string]string
+
+	// PollInterval is the minimum time between two calls to the connect API made by
+	// Refresh.
+	PollInterval time.Duration
+
+	// Include, if not empty, limits the monitored connectors to those with a name matching
+	// at least one of the patterns.
+	Include []*regexp.Regexp
+
+	// Exclude lists patterns of connector names which will not be monitored, even if they
+	// match Include.
+	Exclude []*regexp.Regexp
+
+	// NamePattern, if set, is matched against connector names, and the value of each
+	// named capture group is attached to the connector's metrics as a label of the same
+	// name. The labels are empty for connectors that don't match.
+	NamePattern *regexp.Regexp
+
+	// ConfigLabels lists connector config keys whose values are attached to the
+	// connector's metrics as labels. Label names are the keys, sanitized with
+	// SanitizeLabelName. The labels are empty for connectors without the key.
+	ConfigLabels []string
+
+	// MaxLabelValueLength, if positive, caps the length in bytes of the values of labels
+	// taken from connector configs.
+	MaxLabelValueLength int
+
+	// MaxConnectors, if positive, caps the number of monitored connectors with their own
+	// series. The series of further connectors, in order of name, are aggregated into the
+	// OtherConnector bucket.
+	MaxConnectors int
+
+	// MaxSeries, if positive, caps the number of series of the connectors, including those
+	// of the OtherConnector bucket, which has a series for each state of the aggregated
+	// connectors. Once a connector doesn't fit, it and every further connector are
+	// aggregated into the bucket, as are the last connectors kept, until the bucket fits.
+	MaxSeries int
+
+	// MaxSnapshotAge is how long the last successful snapshot keeps being collected while
+	// updates fail. Once it is older, only its age is collected, until an update succeeds.
+	MaxSnapshotAge time.Duration
+
+	// Metadata, if set, provides the connector metadata exported as the
+	// kafka_connect_connector_metadata_info metric.
+	Metadata MetadataLookup
+}
+
+// MetadataLookup provides metadata about connectors.
+type MetadataLookup interface {
+	// Lookup returns the metadata for the connector, and whether there is any.
+	Lookup(connector string) (metadata.Metadata, bool)
+}
+
+// ConnectClient is the part of the kafka connect REST API used to gather metrics, as
+// implemented by connectapi.Client. Calls are cancelled when their context is done.
 type ConnectClient interface {
 	// List connectors returns a list of connector names.
-	ListConnectors() ([]string, *http.Response, error)
+	ListConnectors(ctx context.Context) ([]string, error)
 
 	// GetConnectorStatus returns the status of a single connector.
-	GetConnectorStatus(string) (*connect.ConnectorStatus, *http.Response, error)
+	GetConnectorStatus(ctx context.Context, name string) (*connectapi.ConnectorStatus, error)
+
+	// GetConnectorConfig returns the config of a single connector.
+	GetConnectorConfig(ctx context.Context, name string) (connectapi.ConnectorConfig, error)
+}
+
+// OtherConnector is the value of the connector label of the series aggregating the
+// connectors over the MaxConnectors and MaxSeries limits.
+const OtherConnector = "__other__"
+
+// Reasons for dropping series, as reported by the series dropped metric.
+const (
+	ReasonMaxConnectors = "max_connectors"
+	ReasonMaxSeries     = "max_series"
+)
+
+// Stages of an update, as reported by UpdateError.
+const (
+	StageListConnectors  = "list_connectors"
+	StageConnectorStatus = "connector_status"
+	StageConnectorConfig = "connector_config"
+)
+
+// UpdateError is returned by Update when a call to the kafka connect API fails.
+type UpdateError struct {
+	// Stage is the API call that failed.
+	Stage string
+
+	// Connector is the connector the failed call was made for, if any.
+	Connector string
+
+	err error
+}
+
+func (e *UpdateError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *UpdateError) Cause() error {
+	return e.err
+}
+
+// LogFields returns the stage and connector as structured log fields.
+func (e *UpdateError) LogFields() []interface{} {
+	fields := []interface{}{"stage", e.Stage}
+	if e.Connector != "" {
+		fields = append(fields, "connector", e.Connector)
+	}
+	return fields
+}
+
+// Validate checks that the metric names are valid, and that the label names of every
+// metric family are valid and distinct.
+func (o Opts) Validate() error {
+	for _, name := range []string{o.Namespace, o.Subsystem} {
+		if name != "" && !metricNameRE.MatchString(name) {
+			return errors.Errorf("%q is not a valid metric name prefix", name)
+		}
+	}
+	for old, name := range o.LabelNames {
+		if !knownLabel(old) {
+			return errors.Errorf("unknown label %q can't be renamed", old)
+		}
+		if !validLabelName(name) {
+			return errors.Errorf("%q is not a valid label name", name)
+		}
+	}
+	for name := range o.ConstLabels {
+		if !validLabelName(name) {
+			return errors.Errorf("%q is not a valid label name", name)
+		}
+	}
+
+	families := make([]string, 0, len(familyLabels))
+	for family := range familyLabels {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	for _, family := range families {
+		seen := make(map[string]bool)
+		for _, name := range o.labels(family) {
+			if seen[name] {
+				return errors.Errorf("label %q is used more than once by metric %s", name, family)
+			}
+			seen[name] = true
+		}
+	}
+	return nil
+}
+
+func validLabelName(name string) bool {
+	return labelNameRE.MatchString(name) && !strings.HasPrefix(name, "__")
+}
+
+// knownLabel reports whether name is one of the exporter's labels.
+func knownLabel(name string) bool {
+	for _, labels := range familyLabels {
+		for _, l := range labels {
+			if l == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// labels returns every label name of the metric family, after renaming.
+func (o Opts) labels(family string) []string {
+	var names []string
+	for _, name := range familyLabels[family] {
+		if name != LabelCluster || o.Cluster != "" {
+			names = append(names, renamed(o.LabelNames, name))
+		}
+	}
+	for name := range o.ConstLabels {
+		names = append(names, name)
+	}
+	if family == "tasks" {
+		names = append(names, nameLabels(o.NamePattern)...)
+		for _, key := range o.ConfigLabels {
+			names = append(names, SanitizeLabelName(key))
+		}
+	}
+	return names
+}
+
+// renamed returns the name label has been renamed to, if any.
+func renamed(names map[string]string, label string) string {
+	if name, ok := names[label]; ok {
+		return name
+	}
+	return label
+}
+
+// ExporterMetricName returns the full name of a metric about the exporter itself, rather
+// than kafka connect, such as api_retries_total: by default, the name is prefixed with
+// kafka_connect_exporter_, and the "kafka_connect" part follows the configured namespace
+// and subsystem.
+func (o Opts) ExporterMetricName(name string) string {
+	namespace, subsystem := o.Namespace, o.Subsystem
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if subsystem == "" {
+		subsystem = DefaultSubsystem
+	}
+	return prom.BuildFQName(namespace, subsystem, "exporter_"+name)
 }
 
 // NewMetrics returns a new instance of prometheus metrics using the given client, and
 // it will start polling the connect API at the given pollInterval.
 func NewMetrics(client ConnectClient) *Metrics {
-	return &Metrics{
-		client: client,
+	return NewMetricsWithOpts(client, Opts{})
+}
+
+// NewMetricsWithOpts returns a new instance of prometheus metrics using the given client
+// and options.
+func NewMetricsWithOpts(client ConnectClient, opts Opts) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	if opts.Subsystem == "" {
+		opts.Subsystem = DefaultSubsystem
+	}
+	constLabels := make(prom.Labels, len(opts.ConstLabels)+1)
+	for name, value := range opts.ConstLabels {
+		constLabels[name] = value
+	}
+	if opts.Cluster != "" {
+		constLabels[renamed(opts.LabelNames, LabelCluster)] = opts.Cluster
+	}
+	label := func(name string) string {
+		return renamed(opts.LabelNames, name)
+	}
+	labels := []string{label(LabelConnector), label(LabelState), label(LabelWorker)}
+	labels = append(labels, nameLabels(opts.NamePattern)...)
+	for _, key := range opts.ConfigLabels {
+		labels = append(labels, SanitizeLabelName(key))
+	}
+	m := &Metrics{
+		labelNames:   opts.LabelNames,
+		client:       client,
+		pollInterval: opts.PollInterval,
+		refreshing:   make(chan struct{}, 1),
+		include:      opts.Include,
+		exclude:      opts.Exclude,
+		namePattern:  opts.NamePattern,
+		configLabels: opts.ConfigLabels,
+		maxLabelLen:  opts.MaxLabelValueLength,
+		maxConns:     opts.MaxConnectors,
+		maxSeries:    opts.MaxSeries,
+		otherLabels:  otherLabels(labels, label(LabelConnector)),
+		maxAge:       opts.MaxSnapshotAge,
+		truncated: prom.NewGauge(prom.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        "scrape_truncated",
+			Help:        "whether the last collection from the kafka connect API was cut short by its deadline",
+			ConstLabels: constLabels,
+		}),
+		retries: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name:        opts.ExporterMetricName("api_retries_total"),
+				Help:        "retried calls to the kafka connect API, by reason",
+				ConstLabels: constLabels,
+			},
+			[]string{label(LabelReason)},
+		),
+		ageDesc: prom.NewDesc(
+			prom.BuildFQName(opts.Namespace, opts.Subsystem, "snapshot_age_seconds"),
+			"time since the last successful collection from the kafka connect API",
+			nil,
+			constLabels,
+		),
+		dropped: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name:        opts.ExporterMetricName("series_dropped_total"),
+				Help:        "series of connectors newly over the configured limits, aggregated into the " + OtherConnector + " connector",
+				ConstLabels: constLabels,
+			},
+			[]string{label(LabelReason)},
+		),
+		metadata: opts.Metadata,
+		info: prom.NewGaugeVec(
+			prom.GaugeOpts{
+				Namespace:   opts.Namespace,
+				Subsystem:   opts.Subsystem,
+				Name:        "connector_metadata_info",
+				Help:        "connector metadata from the metadata catalog",
+				ConstLabels: constLabels,
+			},
+			[]string{label(LabelConnector), label(LabelOwner), label(LabelTier), label(LabelRunbookURL), label(LabelSlackChannel)},
+		),
 		GaugeVec: prom.NewGaugeVec(
 			prom.GaugeOpts{
-				Namespace: "kafka",
-				Subsystem: "connect",
-				Name:      "tasks",
-				Help:      "deployed tasks",
+				Namespace:   opts.Namespace,
+				Subsystem:   opts.Subsystem,
+				Name:        "tasks",
+				Help:        "deployed tasks",
+				ConstLabels: constLabels,
 			},
-			[]string{"connector", "state", "worker"},
+			labels,
 		),
 	}
+	// the dropped series of configured limits are exported as zero until they are reached.
+	if m.maxConns > 0 {
+		m.dropped.WithLabelValues(ReasonMaxConnectors)
+	}
+	if m.maxSeries > 0 {
+		m.dropped.WithLabelValues(ReasonMaxSeries)
+	}
+	return m
 }
 
-// update will update all metrics for the monitored set of kafka connect configs. It
-// returns an error if any underlying API calls to kafka connect fail, either by connection
-// or non-2XX status code.
-func (m *Metrics) Update() error {
-	conns, res, err := m.client.ListConnectors()
-	if err != nil {
-		return errors.Wrap(err, "listing connectors")
+// otherLabels returns the labels of the series aggregating connectors over the limits,
+// with every label other than the connector empty.
+func otherLabels(names []string, connector string) prom.Labels {
+	labels := make(prom.Labels, len(names))
+	for _, name := range names {
+		labels[name] = ""
 	}
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return errors.Errorf("status code %d from listing connectors", res.StatusCode)
+	labels[connector] = OtherConnector
+	return labels
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prom.Desc) {
+	m.GaugeVec.Describe(ch)
+	m.info.Describe(ch)
+	m.dropped.Describe(ch)
+	m.retries.Describe(ch)
+	m.truncated.Describe(ch)
+	ch <- m.ageDesc
+}
+
+// CountRetry counts a retried call to the kafka connect API, for the given reason.
+func (m *Metrics) CountRetry(reason string) {
+	m.retries.WithLabelValues(reason).Inc()
+}
+
+// Collect implements prometheus.Collector. The connector metrics of the last successful
+// snapshot are collected while updates succeed, or for up to the max snapshot age once
+// they fail.
+func (m *Metrics) Collect(ch chan<- prom.Metric) {
+	m.retries.Collect(ch)
+
+	m.snapMu.RLock()
+	defer m.snapMu.RUnlock()
+
+	if m.snapshotAt.IsZero() {
+		return
 	}
+	age := time.Since(m.snapshotAt)
+	if !m.failing || age <= m.maxAge {
+		m.GaugeVec.Collect(ch)
+		m.info.Collect(ch)
+	}
+	m.dropped.Collect(ch)
+	m.truncated.Collect(ch)
+	ch <- prom.MustNewConstMetric(m.ageDesc, prom.GaugeValue, age.Seconds())
+}
 
-	if len(conns) == 0 {
+// nameLabels returns the names of the capture groups in pattern.
+func nameLabels(pattern *regexp.Regexp) []string {
+	if pattern == nil {
 		return nil
 	}
+	var names []string
+	for _, name := range pattern.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-	m.Reset()
+// monitored reports whether the connector passes the include and exclude filters.
+func (m *Metrics) monitored(conn string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(conn) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, re := range m.include {
+		if re.MatchString(conn) {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeLabelName returns name with every character that is not valid in a prometheus
+// label name replaced by an underscore.
+func SanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9'
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+// connectorLabels returns the labels shared by all of a connector's metrics, which are
+// derived from its name and config.
+func (m *Metrics) connectorLabels(conn string, config connectapi.ConnectorConfig) prom.Labels {
+	labels := prom.Labels{m.label(LabelConnector): conn}
+	if m.namePattern != nil {
+		match := m.namePattern.FindStringSubmatch(conn)
+		for i, name := range m.namePattern.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			labels[name] = ""
+			if match != nil {
+				labels[name] = match[i]
+			}
+		}
+	}
+	for _, key := range m.configLabels {
+		labels[SanitizeLabelName(key)] = truncate(config[key], m.maxLabelLen)
+	}
+	return labels
+}
+
+// truncate returns s cut to at most max bytes, without splitting a UTF-8 character. If
+// max is not positive, s is returned unchanged.
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// label returns the name of one of the exporter's labels, after renaming.
+func (m *Metrics) label(name string) string {
+	return renamed(m.labelNames, name)
+}
 
+// withState returns a copy of the connector's labels, with the state and worker labels
+// set.
+func (m *Metrics) withState(labels prom.Labels, state, worker string) prom.Labels {
+	cp := make(prom.Labels, len(labels)+2)
+	for k, v := range labels {
+		cp[k] = v
+	}
+	cp[m.label(LabelState)] = state
+	cp[m.label(LabelWorker)] = worker
+	return cp
+}
+
+// Refresh calls Update, unless the last complete update happened less than the
+// configured poll interval ago, in which case the current metrics are kept. It is safe
+// to call concurrently: a refresh waits for the one in progress, unless ctx is done first,
+// in which case the current metrics are kept and the error of ctx is returned.
+func (m *Metrics) Refresh(ctx context.Context) error {
+	select {
+	case m.refreshing <- struct{}{}:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "waiting for the refresh in progress")
+	}
+	defer func() { <-m.refreshing }()
+
+	if !m.lastUpdate.IsZero() && time.Since(m.lastUpdate) < m.pollInterval {
+		return nil
+	}
+	if err := m.Update(ctx); err != nil {
+		return err
+	}
+	m.lastUpdate = time.Now()
+	return nil
+}
+
+// LastSuccess returns the time of the last successful update, which is zero if there has
+// been none. It never calls the connect API.
+func (m *Metrics) LastSuccess() time.Time {
+	m.snapMu.RLock()
+	defer m.snapMu.RUnlock()
+	return m.snapshotAt
+}
+
+// Update will update all metrics for the monitored set of kafka connect configs. It
+// returns an error if any underlying API calls to kafka connect fail, either by connection
+// or non-2XX status code, in which case the last successful snapshot is kept.
+//
+// If ctx is done once the connectors have been listed, the connectors gathered so far
+// replace the snapshot, the scrape truncated metric is set, and the error is returned. If
+// none were gathered, the update fails and the last snapshot is kept.
+func (m *Metrics) Update(ctx context.Context) error {
+	snapshot, listed, err := m.fetch(ctx)
+	truncated := err != nil && ctx.Err() != nil
+	m.fitSeries(snapshot)
+
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+	if truncated {
+		m.truncated.Set(1)
+	} else {
+		m.truncated.Set(0)
+	}
+	if err != nil && !(truncated && listed && len(snapshot) > 0) {
+		m.failing = true
+		return err
+	}
+	m.failing = false
+	m.partial = truncated
+	m.snapshotAt = time.Now()
+	m.connectors = m.connectorSnapshots(snapshot, truncated, m.snapshotAt)
+	if len(snapshot) > 0 {
+		m.record(snapshot, truncated)
+	}
+	return err
+}
+
+// connectorSnapshot is the state of a single connector, as fetched by an update.
+type connectorSnapshot struct {
+	name   string
+	status *connectapi.ConnectorStatus
+	labels prom.Labels
+	states map[taskState]int
+
+	// metadata is nil if the connector has no metadata.
+	metadata *metadata.Metadata
+
+	// series is the number of series of the connector.
+	series int
+
+	// dropped is the reason the connector is aggregated into OtherConnector, if it is.
+	dropped string
+}
+
+// fetch calls the connect API for the state of every monitored connector. If a call
+// fails, the connectors gathered so far are returned with the error, along with whether
+// the connectors were listed.
+func (m *Metrics) fetch(ctx context.Context) (snapshot []connectorSnapshot, listed bool, err error) {
+	conns, err := m.client.ListConnectors(ctx)
+	if err != nil {
+		return nil, false, &UpdateError{
+			Stage: StageListConnectors,
+			err:   errors.Wrap(err, "listing connectors"),
+		}
+	}
+
+	conns = append([]string(nil), conns...)
+	sort.Strings(conns)
+	var kept, series int
+	var full string // the reason further connectors are dropped, once a limit is reached
 	for _, conn := range conns {
-		connStatus, res, err := m.client.GetConnectorStatus(conn)
+		if !m.monitored(conn) {
+			continue
+		}
+		connStatus, err := m.client.GetConnectorStatus(ctx, conn)
 		if err != nil {
-			return errors.Wrapf(err, "getting status for connector %s", conn)
+			return snapshot, true, &UpdateError{
+				Stage:     StageConnectorStatus,
+				Connector: conn,
+				err:       errors.Wrapf(err, "getting status for connector %s", conn),
+			}
 		}
-		if res.StatusCode < 200 || res.StatusCode >= 300 {
-			return errors.Errorf("status code %d from getting status for connector %s", res.StatusCode, conn)
+
+		c := connectorSnapshot{name: conn, status: connStatus, states: taskStates(connStatus)}
+		c.series = len(c.states)
+		if m.metadata != nil {
+			if md, ok := m.metadata.Lookup(conn); ok {
+				c.metadata = &md
+				c.series++
+			}
+		}
+		switch {
+		case full != "":
+		case m.maxConns > 0 && kept >= m.maxConns:
+			full = ReasonMaxConnectors
+		case m.maxSeries > 0 && series+c.series > m.maxSeries:
+			full = ReasonMaxSeries
 		}
-		if len(connStatus.Tasks) == 0 {
-			//return errors.Errorf("no tasks for connector %s", conn)
-			m.With(prom.Labels{
-				"connector": conn,
-				"state":     "EMPTY_TASKS",
-				"worker":    "-1",
-			}).Inc()
+		if full != "" {
+			c.dropped = full
+			snapshot = append(snapshot, c)
+			continue
 		}
-		m.With(prom.Labels{
-			"connector": conn,
-			"state":     connStatus.Connector.State,
-			"worker":    "toplevel:" + connStatus.Connector.WorkerID,
-		}).Inc()
-		for _, tStatus := range connStatus.Tasks {
-			m.With(prom.Labels{
-				"connector": conn,
-				"state":     tStatus.State,
-				"worker":    tStatus.WorkerID,
-			}).Inc()
+		kept++
+		series += c.series
+
+		var connConfig connectapi.ConnectorConfig
+		if len(m.configLabels) > 0 {
+			connConfig, err = m.client.GetConnectorConfig(ctx, conn)
+			if err != nil {
+				return snapshot, true, &UpdateError{
+					Stage:     StageConnectorConfig,
+					Connector: conn,
+					err:       errors.Wrapf(err, "getting config for connector %s", conn),
+				}
+			}
 		}
+		c.labels = m.connectorLabels(conn, connConfig)
+		snapshot = append(snapshot, c)
 	}
+	return snapshot, true, nil
+}
 
-	return nil
+// fitSeries drops the last connectors kept in the snapshot, until the series of the
+// OtherConnector bucket fit in MaxSeries along with those of the connectors kept.
+func (m *Metrics) fitSeries(snapshot []connectorSnapshot) {
+	if m.maxSeries <= 0 {
+		return
+	}
+	series := 0
+	other := make(map[string]bool)
+	for _, c := range snapshot {
+		if c.dropped == "" {
+			series += c.series
+			continue
+		}
+		for s := range c.states {
+			other[s.state] = true
+		}
+	}
+	for i := len(snapshot) - 1; i >= 0 && series+len(other) > m.maxSeries; i-- {
+		c := &snapshot[i]
+		if c.dropped != "" {
+			continue
+		}
+		c.dropped = ReasonMaxSeries
+		series -= c.series
+		for s := range c.states {
+			other[s.state] = true
+		}
+	}
+}
+
+// record replaces the metrics with those of the snapshot. Only the series of connectors
+// the last update didn't drop are counted as dropped.
+func (m *Metrics) record(snapshot []connectorSnapshot, truncated bool) {
+	m.Reset()
+	m.info.Reset()
+	dropped := make(map[string]bool)
+	if truncated {
+		// the connectors which weren't reached are still dropped.
+		for name := range m.droppedConns {
+			dropped[name] = true
+		}
+	}
+	for _, c := range snapshot {
+		if c.dropped != "" {
+			m.overflow(c.states)
+			if !m.droppedConns[c.name] {
+				m.dropped.WithLabelValues(c.dropped).Add(float64(c.series))
+			}
+			dropped[c.name] = true
+			continue
+		}
+		delete(dropped, c.name)
+		if md := c.metadata; md != nil {
+			m.info.WithLabelValues(c.name, md.Owner, md.Tier, md.RunbookURL, md.SlackChannel).Set(1)
+		}
+		for s, count := range c.states {
+			m.With(m.withState(c.labels, s.state, s.worker)).Add(float64(count))
+		}
+	}
+	m.droppedConns = dropped
+}
+
+// taskState is the state of a connector or task, and the worker running it.
+type taskState struct {
+	state, worker string
+}
+
+// taskStates counts the connector's tasks by state and worker, including the connector
+// itself, and a -1 worker in the EMPTY_TASKS state for connectors without tasks. Each
+// entry is a series of the connector.
+func taskStates(status *connectapi.ConnectorStatus) map[taskState]int {
+	states := make(map[taskState]int)
+	if len(status.Tasks) == 0 {
+		states[taskState{"EMPTY_TASKS", "-1"}]++
+	}
+	states[taskState{status.Connector.State, "toplevel:" + status.Connector.WorkerID}]++
+	for _, t := range status.Tasks {
+		states[taskState{t.State, t.WorkerID}]++
+	}
+	return states
+}
+
+// overflow aggregates the states of a connector over the limits into the OtherConnector
+// series, by state only.
+func (m *Metrics) overflow(states map[taskState]int) {
+	for s, count := range states {
+		m.With(m.withState(m.otherLabels, s.state, "")).Add(float64(count))
+	}
 }
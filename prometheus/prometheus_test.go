@@ -1,12 +1,20 @@
 package prometheus_test
 
 import (
+	"context"
 	"errors"
-	"net/http"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
 	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
-	"github.com/go-kafka/connect"
+	prom "github.com/prometheus/client_golang/prometheus"
 )
 
 func TestMetricsUpdateErr(t *testing.T) {
@@ -23,14 +31,14 @@ func TestMetricsUpdateErr(t *testing.T) {
 			client: &mockConnectClient{
 				connectorStatusErr: true,
 				connectors:         []string{"example-connector"},
-				statuses: map[string]*connect.ConnectorStatus{
-					"example-connector": &connect.ConnectorStatus{
+				statuses: map[string]*connectapi.ConnectorStatus{
+					"example-connector": &connectapi.ConnectorStatus{
 						Name: "example-connector",
-						Connector: connect.ConnectorState{
+						Connector: connectapi.ConnectorState{
 							State:    "RUNNING",
 							WorkerID: "example.com:8083",
 						},
-						Tasks: []connect.TaskState{
+						Tasks: []connectapi.TaskState{
 							{
 								ID:       0,
 								State:    "RUNNING",
@@ -50,14 +58,14 @@ func TestMetricsUpdateErr(t *testing.T) {
 			name: "no tasks",
 			client: &mockConnectClient{
 				connectors: []string{"example-connector"},
-				statuses: map[string]*connect.ConnectorStatus{
-					"example-connector": &connect.ConnectorStatus{
+				statuses: map[string]*connectapi.ConnectorStatus{
+					"example-connector": &connectapi.ConnectorStatus{
 						Name: "example-connector",
-						Connector: connect.ConnectorState{
+						Connector: connectapi.ConnectorState{
 							State:    "RUNNING",
 							WorkerID: "example.com:8083",
 						},
-						Tasks: []connect.TaskState{},
+						Tasks: []connectapi.TaskState{},
 					},
 				},
 			},
@@ -67,14 +75,14 @@ func TestMetricsUpdateErr(t *testing.T) {
 			name: "running task",
 			client: &mockConnectClient{
 				connectors: []string{"example-connector"},
-				statuses: map[string]*connect.ConnectorStatus{
-					"example-connector": &connect.ConnectorStatus{
+				statuses: map[string]*connectapi.ConnectorStatus{
+					"example-connector": &connectapi.ConnectorStatus{
 						Name: "example-connector",
-						Connector: connect.ConnectorState{
+						Connector: connectapi.ConnectorState{
 							State:    "RUNNING",
 							WorkerID: "example.com:8083",
 						},
-						Tasks: []connect.TaskState{
+						Tasks: []connectapi.TaskState{
 							{
 								ID:       0,
 								State:    "RUNNING",
@@ -103,7 +111,7 @@ func (tc updateTestCase) assert(t *testing.T) {
 	// set up metrics
 	metrics := prometheus.NewMetrics(tc.client)
 
-	if err := metrics.Update(); err != nil {
+	if err := metrics.Update(context.Background()); err != nil {
 		if !tc.expectErrOnUpdate {
 			t.Fatal(err)
 		}
@@ -112,32 +120,718 @@ func (tc updateTestCase) assert(t *testing.T) {
 	}
 }
 
+func TestMetricsUpdateFilters(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"team-a-orders", "team-b-users", "tmp-test", "other"},
+		statuses: map[string]*connectapi.ConnectorStatus{
+			"team-a-orders": runningConnector("team-a-orders"),
+			"team-b-users":  runningConnector("team-b-users"),
+			"tmp-test":      runningConnector("tmp-test"),
+			"other":         runningConnector("other"),
+		},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{
+		Include:     []*regexp.Regexp{regexp.MustCompile(`^team-`), regexp.MustCompile(`^tmp-`)},
+		Exclude:     []*regexp.Regexp{regexp.MustCompile(`^tmp-`)},
+		NamePattern: regexp.MustCompile(`^team-(?P<team>[a-z]+)-(?P<pipeline>.+)$`),
+	})
+
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(client.statusCalls)
+	if strings.Join(client.statusCalls, ",") != "team-a-orders,team-b-users" {
+		t.Errorf("unexpected status calls %v", client.statusCalls)
+	}
+
+	expect := []string{
+		"connector=team-a-orders,pipeline=orders,state=RUNNING,team=a,worker=example.com:8083",
+		"connector=team-a-orders,pipeline=orders,state=RUNNING,team=a,worker=toplevel:example.com:8083",
+		"connector=team-b-users,pipeline=users,state=RUNNING,team=b,worker=example.com:8083",
+		"connector=team-b-users,pipeline=users,state=RUNNING,team=b,worker=toplevel:example.com:8083",
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected series:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestMetricsUpdateConfigLabels(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"orders", "users"},
+		statuses: map[string]*connectapi.ConnectorStatus{
+			"orders": runningConnector("orders"),
+			"users":  runningConnector("users"),
+		},
+		configs: map[string]connectapi.ConnectorConfig{
+			"orders": {"owner": "team-orders", "team.tier": "gold-plated-platinum"},
+			"users":  {"connector.class": "FileStreamSource"},
+		},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{
+		ConfigLabels:        []string{"owner", "team.tier"},
+		MaxLabelValueLength: 4,
+	})
+
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"connector=orders,owner=team,state=RUNNING,team_tier=gold,worker=example.com:8083",
+		"connector=orders,owner=team,state=RUNNING,team_tier=gold,worker=toplevel:example.com:8083",
+		"connector=users,owner=,state=RUNNING,team_tier=,worker=example.com:8083",
+		"connector=users,owner=,state=RUNNING,team_tier=,worker=toplevel:example.com:8083",
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected series:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestMetricsUpdateMetadata(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"orders", "users"},
+		statuses: map[string]*connectapi.ConnectorStatus{
+			"orders": runningConnector("orders"),
+			"users":  runningConnector("users"),
+		},
+	}
+	catalog, err := metadata.ParseYAML([]byte(`
+connectors:
+  - pattern: "^ord"
+    owner: team-orders
+    runbook-url: https://runbooks.example.com/orders
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{Metadata: catalog})
+
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"connector=orders,owner=team-orders,runbook_url=https://runbooks.example.com/orders,slack_channel=,tier=",
+		"connector=orders,state=RUNNING,worker=example.com:8083",
+		"connector=orders,state=RUNNING,worker=toplevel:example.com:8083",
+		"connector=users,state=RUNNING,worker=example.com:8083",
+		"connector=users,state=RUNNING,worker=toplevel:example.com:8083",
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected series:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestMetricsNaming(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"orders"},
+		statuses:   map[string]*connectapi.ConnectorStatus{"orders": runningConnector("orders")},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{
+		Cluster:     "primary",
+		Namespace:   "acme",
+		Subsystem:   "kc",
+		ConstLabels: map[string]string{"environment": "production"},
+		LabelNames: map[string]string{
+			prometheus.LabelCluster:   "kafka_cluster",
+			prometheus.LabelConnector: "kafka_connector",
+		},
+		MaxSeries: 10,
+	})
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	metrics.CountRetry("timeout")
+
+	reg := prom.NewRegistry()
+	reg.MustRegister(metrics)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range families {
+		names = append(names, f.GetName())
+	}
+	if got := strings.Join(names, ","); got != "acme_kc_exporter_api_retries_total,acme_kc_exporter_series_dropped_total,acme_kc_scrape_truncated,acme_kc_snapshot_age_seconds,acme_kc_tasks" {
+		t.Fatalf("unexpected metric families %s", got)
+	}
+	expect := []string{
+		"environment=production,kafka_cluster=primary,kafka_connector=orders,state=RUNNING,worker=example.com:8083",
+		"environment=production,kafka_cluster=primary,kafka_connector=orders,state=RUNNING,worker=toplevel:example.com:8083",
+		"environment=production,kafka_cluster=primary,reason=max_series",
+		"environment=production,kafka_cluster=primary,reason=timeout",
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected series:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestOptsValidate(t *testing.T) {
+	for name, opts := range map[string]prometheus.Opts{
+		"invalid namespace":   {Namespace: "acme-corp"},
+		"unknown label":       {LabelNames: map[string]string{"team": "squad"}},
+		"invalid label name":  {LabelNames: map[string]string{prometheus.LabelState: "__state"}},
+		"invalid const label": {ConstLabels: map[string]string{"1st": "a"}},
+		"renamed label clash": {LabelNames: map[string]string{prometheus.LabelState: prometheus.LabelWorker}},
+		"const label clash":   {ConstLabels: map[string]string{prometheus.LabelConnector: "a"}},
+		"config label clash":  {ConfigLabels: []string{"env"}, ConstLabels: map[string]string{"env": "a"}},
+		"named cluster clash": {Cluster: "a", LabelNames: map[string]string{prometheus.LabelCluster: prometheus.LabelTier}},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	valid := prometheus.Opts{
+		ConstLabels: map[string]string{"cluster": "a"},
+		LabelNames:  map[string]string{prometheus.LabelOwner: "team"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestWithConstLabels(t *testing.T) {
+	reg := prom.NewRegistry()
+	gauge := prom.NewGauge(prom.GaugeOpts{Name: "up", Help: "up", ConstLabels: prom.Labels{"job": "exporter"}})
+	reg.MustRegister(gauge)
+
+	families, err := prometheus.WithConstLabels(reg, map[string]string{"environment": "production", "job": "other"}).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pairs []string
+	for _, l := range families[0].Metric[0].Label {
+		pairs = append(pairs, l.GetName()+"="+l.GetValue())
+	}
+	if got := strings.Join(pairs, ","); got != "environment=production,job=exporter" {
+		t.Errorf("unexpected labels %s", got)
+	}
+}
+
+func TestMetricsUpdateLimits(t *testing.T) {
+	testCases := []limitsTestCase{
+		{
+			name: "max connectors",
+			opts: prometheus.Opts{MaxConnectors: 2},
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=b,state=RUNNING,worker=example.com:8083":          1,
+				"connector=b,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=__other__,state=RUNNING,worker=":                  4,
+				"reason=max_connectors":                                      4,
+			},
+		},
+		{
+			name: "max series",
+			opts: prometheus.Opts{MaxSeries: 3},
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=__other__,state=RUNNING,worker=":                  6,
+				"reason=max_series": 6,
+			},
+		},
+		{
+			name: "max series reached by a large connector",
+			opts: prometheus.Opts{MaxSeries: 5},
+			statuses: map[string]*connectapi.ConnectorStatus{
+				"b": spreadConnector("b", 3),
+			},
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=__other__,state=RUNNING,worker=":                  8,
+				"reason=max_series": 8,
+			},
+		},
+		{
+			name: "max series including the other connector",
+			opts: prometheus.Opts{MaxSeries: 4},
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=__other__,state=RUNNING,worker=":                  6,
+				"reason=max_series": 6,
+			},
+		},
+		{
+			name:    "dropped series counted once",
+			opts:    prometheus.Opts{MaxConnectors: 2},
+			updates: 3,
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=b,state=RUNNING,worker=example.com:8083":          1,
+				"connector=b,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=__other__,state=RUNNING,worker=":                  4,
+				"reason=max_connectors":                                      4,
+			},
+		},
+		{
+			name: "within limits",
+			opts: prometheus.Opts{MaxConnectors: 4, MaxSeries: 8},
+			expect: map[string]float64{
+				"connector=a,state=RUNNING,worker=example.com:8083":          1,
+				"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=b,state=RUNNING,worker=example.com:8083":          1,
+				"connector=b,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=c,state=RUNNING,worker=example.com:8083":          1,
+				"connector=c,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"connector=d,state=RUNNING,worker=example.com:8083":          1,
+				"connector=d,state=RUNNING,worker=toplevel:example.com:8083": 1,
+				"reason=max_connectors":                                      0,
+				"reason=max_series":                                          0,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+type limitsTestCase struct {
+	name string
+	opts prometheus.Opts
+
+	// statuses replace the status of the running connectors a, b, c and d.
+	statuses map[string]*connectapi.ConnectorStatus
+
+	// updates is the number of updates made, 1 if not set.
+	updates int
+	expect  map[string]float64
+}
+
+func (tc limitsTestCase) assert(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"d", "a", "c", "b"},
+		statuses: map[string]*connectapi.ConnectorStatus{
+			"a": runningConnector("a"),
+			"b": runningConnector("b"),
+			"c": runningConnector("c"),
+			"d": runningConnector("d"),
+		},
+	}
+	for name, status := range tc.statuses {
+		client.statuses[name] = status
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, tc.opts)
+	for i := 0; i < tc.updates || i == 0; i++ {
+		if err := metrics.Update(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := gatherValues(t, metrics)
+	if len(got) != len(tc.expect) {
+		t.Errorf("expected %d series, got %v", len(tc.expect), got)
+	}
+	for series, expect := range tc.expect {
+		if value, ok := got[series]; !ok || value != expect {
+			t.Errorf("expected %s to be %v, got %v", series, expect, got)
+		}
+	}
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"orders"},
+		statuses:   map[string]*connectapi.ConnectorStatus{"orders": runningConnector("orders")},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{MaxSnapshotAge: 50 * time.Millisecond})
+	if !metrics.LastSuccess().IsZero() {
+		t.Error("expected no successful update yet")
+	}
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	success := metrics.LastSuccess()
+	if success.IsZero() {
+		t.Error("expected a successful update")
+	}
+	expect := []string{
+		"connector=orders,state=RUNNING,worker=example.com:8083",
+		"connector=orders,state=RUNNING,worker=toplevel:example.com:8083",
+	}
+
+	client.listConnectorErr = true
+	if err := metrics.Update(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !metrics.LastSuccess().Equal(success) {
+		t.Error("expected a failed update to keep the time of the last success")
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("expected the last snapshot while fresh, got:\n%s", strings.Join(got, "\n"))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := gatherLabels(t, metrics); len(got) != 0 {
+		t.Errorf("expected no series once stale, got:\n%s", strings.Join(got, "\n"))
+	}
+	if age := gatherGauge(t, metrics, "kafka_connect_snapshot_age_seconds"); age < 0.06 {
+		t.Errorf("expected a snapshot age of at least 60ms, got %vs", age)
+	}
+
+	client.listConnectorErr = false
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := gatherLabels(t, metrics); strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("expected a new snapshot, got:\n%s", strings.Join(got, "\n"))
+	}
+	if age := gatherGauge(t, metrics, "kafka_connect_snapshot_age_seconds"); age >= 0.06 {
+		t.Errorf("expected the snapshot age to be reset, got %vs", age)
+	}
+}
+
+// gatherGauge returns the value of the single series of the named gauge collected from c.
+func gatherGauge(t *testing.T, c prom.Collector, name string) float64 {
+	reg := prom.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.Metric[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("no %s metric", name)
+	return 0
+}
+
+func TestMetricsUpdateTruncated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &mockConnectClient{
+		connectors: []string{"a", "b", "c"},
+		statuses: map[string]*connectapi.ConnectorStatus{
+			"a": runningConnector("a"),
+			"b": runningConnector("b"),
+			"c": runningConnector("c"),
+		},
+		cancel:      cancel,
+		cancelAfter: 2,
+	}
+	metrics := prometheus.NewMetrics(client)
+
+	if err := metrics.Update(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	expect := map[string]float64{
+		"connector=a,state=RUNNING,worker=example.com:8083":          1,
+		"connector=a,state=RUNNING,worker=toplevel:example.com:8083": 1,
+		"connector=b,state=RUNNING,worker=example.com:8083":          1,
+		"connector=b,state=RUNNING,worker=toplevel:example.com:8083": 1,
+	}
+	got := gatherValues(t, metrics)
+	if len(got) != len(expect) {
+		t.Errorf("expected %d series, got %v", len(expect), got)
+	}
+	for series, value := range expect {
+		if got[series] != value {
+			t.Errorf("expected %q to be %v, got %v", series, value, got)
+		}
+	}
+	if truncated := gatherGauge(t, metrics, "kafka_connect_scrape_truncated"); truncated != 1 {
+		t.Errorf("expected the scrape to be flagged as truncated, got %v", truncated)
+	}
+	if snap := metrics.Snapshot(); !snap.Truncated || len(snap.Connectors) != 2 {
+		t.Errorf("expected a truncated snapshot of 2 connectors, got %+v", snap)
+	}
+
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := gatherValues(t, metrics); len(got) != 6 {
+		t.Errorf("expected a complete snapshot, got %v", got)
+	}
+	if truncated := gatherGauge(t, metrics, "kafka_connect_scrape_truncated"); truncated != 0 {
+		t.Errorf("expected the truncated flag to be cleared, got %v", truncated)
+	}
+}
+
+func TestMetricsUpdateTruncatedEmpty(t *testing.T) {
+	client := &mockConnectClient{
+		connectors: []string{"orders"},
+		statuses:   map[string]*connectapi.ConnectorStatus{"orders": runningConnector("orders")},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{MaxSnapshotAge: 50 * time.Millisecond})
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	success := metrics.LastSuccess()
+	time.Sleep(60 * time.Millisecond)
+
+	// the connectors are listed, but the context is done before any is fetched.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := metrics.Update(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !metrics.LastSuccess().Equal(success) {
+		t.Error("expected an update without connectors to keep the time of the last success")
+	}
+	snap := metrics.Snapshot()
+	if !snap.Failing || !snap.Stale {
+		t.Errorf("expected a failing, stale snapshot, got %+v", snap)
+	}
+	if len(snap.Connectors) != 1 {
+		t.Errorf("expected the last snapshot to be kept, got %+v", snap.Connectors)
+	}
+	if got := gatherLabels(t, metrics); len(got) != 0 {
+		t.Errorf("expected no series once stale, got:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestMetricsRefreshWaiting(t *testing.T) {
+	client := &blockingConnectClient{
+		mockConnectClient: &mockConnectClient{},
+		listing:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	metrics := prometheus.NewMetrics(client)
+
+	done := make(chan error)
+	go func() {
+		done <- metrics.Refresh(context.Background())
+	}()
+	<-client.listing
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := metrics.Refresh(ctx); err == nil {
+		t.Error("expected an error while the refresh in progress is blocked")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the refresh to give up at the deadline, waited %v", elapsed)
+	}
+
+	close(client.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := metrics.Refresh(context.Background()); err != nil {
+		t.Errorf("expected a refresh once the one in progress is done, got %v", err)
+	}
+}
+
+func TestMetricsSnapshotConnectors(t *testing.T) {
+	failed := runningConnector("orders")
+	failed.Tasks = append(failed.Tasks, connectapi.TaskState{ID: 1, State: "FAILED", WorkerID: "example.com:8083", Trace: "boom"})
+	client := &mockConnectClient{
+		connectors: []string{"orders"},
+		statuses:   map[string]*connectapi.ConnectorStatus{"orders": runningConnector("orders")},
+		configs:    map[string]connectapi.ConnectorConfig{"orders": {"topics": "orders"}},
+	}
+	metrics := prometheus.NewMetricsWithOpts(client, prometheus.Opts{
+		ConfigLabels: []string{"topics"},
+		LabelNames:   map[string]string{prometheus.LabelConnector: "kafka_connector"},
+	})
+	if snap := metrics.Snapshot(); !snap.CollectedAt.IsZero() || len(snap.Connectors) != 0 {
+		t.Errorf("expected an empty snapshot before any update, got %+v", snap)
+	}
+
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := metrics.Snapshot().Connectors
+	if len(first) != 1 || len(first[0].Tasks) != 1 {
+		t.Fatalf("unexpected connectors %+v", first)
+	}
+	if labels := first[0].Labels; len(labels) != 1 || labels["topics"] != "orders" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	client.statuses["orders"] = failed
+	if err := metrics.Update(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	second := metrics.Snapshot().Connectors
+	if len(second) != 1 || len(second[0].Tasks) != 2 {
+		t.Fatalf("unexpected connectors %+v", second)
+	}
+	if !second[0].Since.Equal(first[0].Since) || !second[0].Tasks[0].Since.Equal(first[0].Tasks[0].Since) {
+		t.Error("expected the since time of unchanged states to be kept")
+	}
+	if task := second[0].Tasks[1]; task.State != "FAILED" || task.Trace != "boom" || !task.Since.After(first[0].Since) {
+		t.Errorf("unexpected task %+v", task)
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"owner":      "owner",
+		"team.tier":  "team_tier",
+		"1st-choice": "_st_choice",
+		"":           "_",
+	} {
+		if got := prometheus.SanitizeLabelName(name); got != expect {
+			t.Errorf("expected %q for %q, got %q", expect, name, got)
+		}
+	}
+}
+
+func runningConnector(name string) *connectapi.ConnectorStatus {
+	return &connectapi.ConnectorStatus{
+		Name: name,
+		Connector: connectapi.ConnectorState{
+			State:    "RUNNING",
+			WorkerID: "example.com:8083",
+		},
+		Tasks: []connectapi.TaskState{
+			{
+				ID:       0,
+				State:    "RUNNING",
+				WorkerID: "example.com:8083",
+			},
+		},
+	}
+}
+
+// collectionFamily reports whether the metric family describes the collection from the API,
+// rather than connectors.
+// spreadConnector returns a running connector with n running tasks, each on its own
+// worker.
+func spreadConnector(name string, n int) *connectapi.ConnectorStatus {
+	status := runningConnector(name)
+	status.Tasks = nil
+	for i := 0; i < n; i++ {
+		status.Tasks = append(status.Tasks, connectapi.TaskState{ID: i, State: "RUNNING", WorkerID: fmt.Sprintf("worker-%d:8083", i)})
+	}
+	return status
+}
+
+func collectionFamily(name string) bool {
+	return strings.HasSuffix(name, "_snapshot_age_seconds") || strings.HasSuffix(name, "_scrape_truncated")
+}
+
+// gatherLabels returns the sorted label sets of every series collected from c, other than
+// those describing the collection, each formatted as comma separated name=value pairs.
+func gatherLabels(t *testing.T, c prom.Collector) []string {
+	reg := prom.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []string
+	for _, f := range families {
+		if collectionFamily(f.GetName()) {
+			continue
+		}
+		for _, m := range f.Metric {
+			var pairs []string
+			for _, l := range m.Label {
+				pairs = append(pairs, l.GetName()+"="+l.GetValue())
+			}
+			series = append(series, strings.Join(pairs, ","))
+		}
+	}
+	sort.Strings(series)
+	return series
+}
+
+// gatherValues returns the value of every gauge and counter collected from c, by label set
+// formatted as in gatherLabels.
+func gatherValues(t *testing.T, c prom.Collector) map[string]float64 {
+	reg := prom.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		if collectionFamily(f.GetName()) {
+			continue
+		}
+		for _, m := range f.Metric {
+			var pairs []string
+			for _, l := range m.Label {
+				pairs = append(pairs, l.GetName()+"="+l.GetValue())
+			}
+			values[strings.Join(pairs, ",")] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	return values
+}
+
 type mockConnectClient struct {
 	listConnectorErr   bool
 	listCallCount      int
+	statusCalls        []string
 	connectorStatusErr bool
 	connectors         []string
-	statuses           map[string]*connect.ConnectorStatus
+	statuses           map[string]*connectapi.ConnectorStatus
+	configs            map[string]connectapi.ConnectorConfig
+
+	// cancel, if set, is called once cancelAfter statuses have been returned.
+	cancel      context.CancelFunc
+	cancelAfter int
 }
 
-func (c *mockConnectClient) ListConnectors() ([]string, *http.Response, error) {
+func (c *mockConnectClient) ListConnectors(ctx context.Context) ([]string, error) {
 	c.listCallCount++
 	if c.listConnectorErr {
-		return nil, nil, errors.New("error listing connectors")
+		return nil, errors.New("error listing connectors")
 	}
-	return c.connectors, &http.Response{StatusCode: 200}, nil
+	return c.connectors, nil
+}
+
+// blockingConnectClient blocks listing connectors until release is closed, closing
+// listing once it first starts.
+type blockingConnectClient struct {
+	*mockConnectClient
+	once    sync.Once
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingConnectClient) ListConnectors(ctx context.Context) ([]string, error) {
+	c.once.Do(func() { close(c.listing) })
+	<-c.release
+	return c.mockConnectClient.ListConnectors(ctx)
 }
 
-func (c *mockConnectClient) GetConnectorStatus(connector string) (*connect.ConnectorStatus, *http.Response, error) {
+func (c *mockConnectClient) GetConnectorStatus(ctx context.Context, connector string) (*connectapi.ConnectorStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.statusCalls = append(c.statusCalls, connector)
+	if c.cancel != nil && len(c.statusCalls) == c.cancelAfter {
+		defer c.cancel()
+	}
 	if c.connectorStatusErr {
-		return nil, nil, errors.New("error getting connector status")
+		return nil, errors.New("error getting connector status")
 	}
 	status, ok := c.statuses[connector]
 	if !ok {
-		return nil, &http.Response{StatusCode: 404}, nil
+		return nil, &connectapi.APIError{StatusCode: 404}
 	}
 	if status == nil {
-		return nil, &http.Response{StatusCode: 500}, nil
+		return nil, &connectapi.APIError{StatusCode: 500}
+	}
+	return status, nil
+}
+
+func (c *mockConnectClient) GetConnectorConfig(ctx context.Context, connector string) (connectapi.ConnectorConfig, error) {
+	config, ok := c.configs[connector]
+	if !ok {
+		return nil, &connectapi.APIError{StatusCode: 404}
 	}
-	return status, &http.Response{StatusCode: 200}, nil
+	return config, nil
 }
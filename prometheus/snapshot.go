@@ -0,0 +1,144 @@
+package prometheus
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/metadata"
+)
+
+// Snapshot is the state of the monitored connectors of a cluster, as of the last
+// successful update.
+type Snapshot struct {
+	// CollectedAt is the time of the last successful update, which is zero if there has
+	// been none.
+	CollectedAt time.Time
+
+	// Failing reports whether the updates since CollectedAt have failed.
+	Failing bool
+
+	// Stale reports whether the snapshot is failing and older than the max snapshot age,
+	// in which case its connector metrics are no longer collected.
+	Stale bool
+
+	// Truncated reports whether the last update was cut short by its deadline, in which
+	// case Connectors only has the connectors gathered by then.
+	Truncated bool
+
+	// Connectors are the monitored connectors, in order of name.
+	Connectors []ConnectorSnapshot
+}
+
+// ConnectorSnapshot is the state of a single connector and its tasks.
+type ConnectorSnapshot struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	State    string `json:"state"`
+	WorkerID string `json:"worker_id"`
+	Trace    string `json:"trace,omitempty"`
+
+	// Since is when the connector was first seen in its current state.
+	Since time.Time `json:"since"`
+
+	// Labels are the labels derived from the connector's name and config. They are nil
+	// for connectors over the limits.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Metadata is the connector's metadata from the catalog, if any.
+	Metadata *metadata.Metadata `json:"metadata,omitempty"`
+
+	Tasks []TaskSnapshot `json:"tasks"`
+
+	// Dropped is the reason the connector's series are aggregated into OtherConnector, if
+	// they are.
+	Dropped string `json:"dropped,omitempty"`
+}
+
+// TaskSnapshot is the state of a single task.
+type TaskSnapshot struct {
+	ID       int    `json:"id"`
+	State    string `json:"state"`
+	WorkerID string `json:"worker_id"`
+	Trace    string `json:"trace,omitempty"`
+
+	// Since is when the task was first seen in its current state.
+	Since time.Time `json:"since"`
+}
+
+// Snapshot returns the state of the connectors as of the last successful update. It never
+// calls the connect API. The returned connectors are shared, and must not be modified.
+func (m *Metrics) Snapshot() Snapshot {
+	m.snapMu.RLock()
+	defer m.snapMu.RUnlock()
+	return Snapshot{
+		CollectedAt: m.snapshotAt,
+		Failing:     m.failing,
+		Stale:       m.failing && !m.snapshotAt.IsZero() && time.Since(m.snapshotAt) > m.maxAge,
+		Truncated:   m.partial,
+		Connectors:  m.connectors,
+	}
+}
+
+// transition is the state of a connector or task, and when it was first seen.
+type transition struct {
+	state string
+	since time.Time
+}
+
+// connectorSnapshots returns the snapshots of the connectors, recording the transitions
+// of their states since the previous snapshot, as of now. The transitions of connectors
+// missing from a partial snapshot are kept.
+func (m *Metrics) connectorSnapshots(snapshot []connectorSnapshot, partial bool, now time.Time) []ConnectorSnapshot {
+	seen := make(map[string]transition, len(m.transitions))
+	if partial {
+		for key, t := range m.transitions {
+			seen[key] = t
+		}
+	}
+	since := func(key, state string) time.Time {
+		t, ok := m.transitions[key]
+		if !ok || t.state != state {
+			t = transition{state, now}
+		}
+		seen[key] = t
+		return t.since
+	}
+
+	conns := make([]ConnectorSnapshot, 0, len(snapshot))
+	for _, c := range snapshot {
+		status := c.status
+		conn := ConnectorSnapshot{
+			Name:     c.name,
+			Type:     status.Type,
+			State:    status.Connector.State,
+			WorkerID: status.Connector.WorkerID,
+			Trace:    status.Connector.Trace,
+			Since:    since(c.name, status.Connector.State),
+			Metadata: c.metadata,
+			Tasks:    make([]TaskSnapshot, 0, len(status.Tasks)),
+			Dropped:  c.dropped,
+		}
+		if c.labels != nil {
+			conn.Labels = make(map[string]string, len(c.labels))
+			for name, value := range c.labels {
+				if name != m.label(LabelConnector) {
+					conn.Labels[name] = value
+				}
+			}
+		}
+		for _, t := range status.Tasks {
+			conn.Tasks = append(conn.Tasks, TaskSnapshot{
+				ID:       t.ID,
+				State:    t.State,
+				WorkerID: t.WorkerID,
+				Trace:    t.Trace,
+				Since:    since(c.name+"/"+strconv.Itoa(t.ID), t.State),
+			})
+		}
+		sort.Slice(conn.Tasks, func(i, j int) bool { return conn.Tasks[i].ID < conn.Tasks[j].ID })
+		conns = append(conns, conn)
+	}
+	m.transitions = seen
+	return conns
+}
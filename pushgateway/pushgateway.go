@@ -0,0 +1,131 @@
+// Package pushgateway pushes metrics to a prometheus pushgateway, for environments which
+// prometheus can't scrape.
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Pusher pushes metrics to the groups of a job on a pushgateway. A group is identified by
+// its grouping key: the job, and a set of labels which the pushgateway attaches to every
+// metric pushed to the group.
+type Pusher struct {
+	// URL is the base URL of the pushgateway, such as http://pushgateway:9091.
+	URL string
+
+	// Job is the job label of every group pushed to.
+	Job string
+
+	// Username and Password, if set, authenticate requests with basic auth, and
+	// BearerToken with a bearer token.
+	Username    string
+	Password    string
+	BearerToken string
+
+	// Client sends the requests to the pushgateway. It defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Push replaces the metrics of the group with grouping labels by the metrics gathered
+// from g.
+func (p *Pusher) Push(ctx context.Context, g prom.Gatherer, grouping map[string]string) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return errors.Wrap(err, "gathering metrics")
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return errors.Wrapf(err, "encoding %s", mf.GetName())
+		}
+	}
+	return p.do(ctx, "PUT", grouping, buf.Bytes())
+}
+
+// Delete deletes the group with grouping labels, and every metric pushed to it.
+func (p *Pusher) Delete(ctx context.Context, grouping map[string]string) error {
+	return p.do(ctx, "DELETE", grouping, nil)
+}
+
+func (p *Pusher) do(ctx context.Context, method string, grouping map[string]string, body []byte) error {
+	u := p.GroupURL(grouping)
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", string(expfmt.FmtProtoDelim))
+	}
+	switch {
+	case p.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	case p.Username != "":
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.Errorf("%s %s: unexpected status %d: %s", method, u, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// GroupURL returns the URL of the group with grouping labels. Labels are sorted by name,
+// and values which can't be part of a path, such as URLs, are base64 encoded.
+func (p *Pusher) GroupURL(grouping map[string]string) string {
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	u := strings.TrimSuffix(p.URL, "/") + "/metrics/" + pathLabel("job", p.Job)
+	for _, name := range names {
+		u += "/" + pathLabel(name, grouping[name])
+	}
+	return u
+}
+
+// pathLabel returns the label as a pair of path segments.
+func pathLabel(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return name + "@base64/" + encodeValue(value)
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// encodeValue returns the base64 encoding of a label value, in which the pushgateway
+// represents an empty value as "=".
+func encodeValue(value string) string {
+	if value == "" {
+		return "="
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
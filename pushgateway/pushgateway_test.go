@@ -0,0 +1,162 @@
+package pushgateway_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/pushgateway"
+	"github.com/autotraderuk/kafka-connect-exporter/transport"
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// request is a request received by the mock pushgateway.
+type request struct {
+	method string
+	path   string
+	auth   string
+	user   string
+	pass   string
+	names  []string
+}
+
+// mockPushgateway records the requests it receives, failing the first ones with the
+// given status codes.
+type mockPushgateway struct {
+	mu       sync.Mutex
+	requests []request
+	failures []int
+}
+
+func (m *mockPushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req := request{method: r.Method, path: r.URL.EscapedPath(), auth: r.Header.Get("Authorization")}
+	req.user, req.pass, _ = r.BasicAuth()
+	if r.Method == "PUT" {
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.names = append(req.names, mf.GetName())
+		}
+	}
+	m.requests = append(m.requests, req)
+	if len(m.failures) > 0 {
+		status := m.failures[0]
+		m.failures = m.failures[1:]
+		http.Error(w, "unavailable", status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func registry(t *testing.T) *prom.Registry {
+	reg := prom.NewRegistry()
+	g := prom.NewGauge(prom.GaugeOpts{Name: "kafka_connect_up", Help: "up"})
+	g.Set(1)
+	if err := reg.Register(g); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+type pushTestCase struct {
+	name     string
+	pusher   pushgateway.Pusher
+	grouping map[string]string
+	failures []int
+	expect   request
+	requests int
+	err      bool
+}
+
+func TestPusherPush(t *testing.T) {
+	retry := &http.Client{Transport: &transport.Retry{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}
+
+	testCases := []pushTestCase{
+		{
+			name:     "basic auth",
+			pusher:   pushgateway.Pusher{Job: "exporter", Username: "user", Password: "secret"},
+			grouping: map[string]string{"cluster": "prod", "env": "ci"},
+			expect:   request{method: "PUT", path: "/metrics/job/exporter/cluster/prod/env/ci", user: "user", pass: "secret", auth: "Basic dXNlcjpzZWNyZXQ=", names: []string{"kafka_connect_up"}},
+			requests: 1,
+		},
+		{
+			name:     "bearer token and encoded values",
+			pusher:   pushgateway.Pusher{Job: "exporter", BearerToken: "token"},
+			grouping: map[string]string{"cluster": "http://connect:8083", "env": ""},
+			expect:   request{method: "PUT", path: "/metrics/job/exporter/cluster@base64/aHR0cDovL2Nvbm5lY3Q6ODA4Mw/env@base64/=", auth: "Bearer token", names: []string{"kafka_connect_up"}},
+			requests: 1,
+		},
+		{
+			name:     "retried",
+			pusher:   pushgateway.Pusher{Job: "exporter", Client: retry},
+			grouping: map[string]string{"cluster": "prod"},
+			failures: []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			expect:   request{method: "PUT", path: "/metrics/job/exporter/cluster/prod", names: []string{"kafka_connect_up"}},
+			requests: 3,
+		},
+		{
+			name:     "rejected",
+			pusher:   pushgateway.Pusher{Job: "exporter", Client: retry},
+			grouping: map[string]string{"cluster": "prod"},
+			failures: []int{http.StatusBadRequest},
+			expect:   request{method: "PUT", path: "/metrics/job/exporter/cluster/prod", names: []string{"kafka_connect_up"}},
+			requests: 1,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc pushTestCase) assert(t *testing.T) {
+	mock := &mockPushgateway{failures: tc.failures}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	tc.pusher.URL = srv.URL + "/"
+	err := tc.pusher.Push(context.Background(), registry(t), tc.grouping)
+	if tc.err != (err != nil) {
+		t.Fatalf("expected error %t, got %v", tc.err, err)
+	}
+	if len(mock.requests) != tc.requests {
+		t.Fatalf("expected %d requests, got %d", tc.requests, len(mock.requests))
+	}
+	got := mock.requests[len(mock.requests)-1]
+	if got.method != tc.expect.method || got.path != tc.expect.path || got.auth != tc.expect.auth ||
+		got.user != tc.expect.user || got.pass != tc.expect.pass ||
+		strings.Join(got.names, ",") != strings.Join(tc.expect.names, ",") {
+		t.Errorf("unexpected request:\nexpected: %+v\ngot:      %+v", tc.expect, got)
+	}
+}
+
+func TestPusherDelete(t *testing.T) {
+	mock := &mockPushgateway{}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	p := pushgateway.Pusher{URL: srv.URL, Job: "exporter", BearerToken: "token"}
+	if err := p.Delete(context.Background(), map[string]string{"cluster": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := request{method: "DELETE", path: "/metrics/job/exporter/cluster/prod", auth: "Bearer token"}
+	if len(mock.requests) != 1 || mock.requests[0].method != expect.method || mock.requests[0].path != expect.path || mock.requests[0].auth != expect.auth {
+		t.Errorf("expected %+v, got %+v", expect, mock.requests)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/config"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// lastReload is the outcome of the last config reload.
+var lastReload struct {
+	sync.Mutex
+	successful bool
+	success    time.Time
+}
+
+// reloadCollector collects the outcome of the last config reload, named after the
+// namespace and subsystem of the current config, as the exporter's other metrics are.
+type reloadCollector struct {
+	successful, success *prom.Desc
+}
+
+func newReloadCollector(opts prometheus.Opts) *reloadCollector {
+	return &reloadCollector{
+		successful: prom.NewDesc(
+			opts.ExporterMetricName("config_last_reload_successful"),
+			"Whether the last configuration reload attempt was successful.",
+			nil,
+			opts.ConstLabels,
+		),
+		success: prom.NewDesc(
+			opts.ExporterMetricName("config_last_reload_success_timestamp_seconds"),
+			"Timestamp of the last successful configuration reload.",
+			nil,
+			opts.ConstLabels,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *reloadCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.successful
+	ch <- c.success
+}
+
+// Collect implements prometheus.Collector.
+func (c *reloadCollector) Collect(ch chan<- prom.Metric) {
+	lastReload.Lock()
+	defer lastReload.Unlock()
+	var successful, success float64
+	if lastReload.successful {
+		successful = 1
+	}
+	if !lastReload.success.IsZero() {
+		success = float64(lastReload.success.Unix())
+	}
+	ch <- prom.MustNewConstMetric(c.successful, prom.GaugeValue, successful)
+	ch <- prom.MustNewConstMetric(c.success, prom.GaugeValue, success)
+}
+
+// reloader reloads the config and applies it to an exporter. If the new config is invalid,
+// or can't be applied, the exporter keeps its current config.
+type reloader struct {
+	loader *config.Loader
+	exp    *exporter
+
+	// mu serialises reloads, so that they are applied in the order they were loaded.
+	mu sync.Mutex
+}
+
+// reload loads the config from all sources, and applies it.
+func (r *reloader) reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record(r.apply(r.loader.Load(ctx)))
+}
+
+// watch reloads the config on SIGHUP, and whenever the config file or remote source
+// changes, until ctx is done.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	go r.loader.Watch(ctx, func(cfg *config.Config, err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.record(r.apply(cfg, err))
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload(ctx)
+		}
+	}
+}
+
+func (r *reloader) apply(cfg *config.Config, err error) error {
+	if err != nil {
+		return err
+	}
+	return r.exp.apply(cfg)
+}
+
+// record updates the reload metrics with the outcome of a reload, and logs any error.
+func (r *reloader) record(err error) error {
+	lastReload.Lock()
+	defer lastReload.Unlock()
+	if err != nil {
+		r.exp.current().log.Error("reloading config, keeping current config", err, "stage", "reload")
+		lastReload.successful = false
+		return err
+	}
+	lastReload.successful = true
+	lastReload.success = time.Now()
+	return nil
+}
+
+// ServeHTTP reloads the config on POST requests.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(req.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
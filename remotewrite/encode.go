@@ -0,0 +1,111 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Label is a label of a time series.
+type Label struct {
+	Name, Value string
+}
+
+// TimeSeries is a single sample of a series, identified by its labels, including
+// __name__.
+type TimeSeries struct {
+	Labels    []Label
+	Value     float64
+	Timestamp time.Time
+}
+
+// Series returns the time series of the metric families, sampled at now unless a metric
+// has a timestamp. Histograms and summaries are split into their _bucket or quantile,
+// _sum and _count series, as prometheus scrapes them.
+func Series(mfs []*dto.MetricFamily, now time.Time) []TimeSeries {
+	var series []TimeSeries
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			ts := now
+			if m.TimestampMs != nil {
+				ts = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+			}
+			add := func(name string, v float64, extra ...Label) {
+				labels := []Label{{Name: "__name__", Value: name}}
+				for _, l := range m.GetLabel() {
+					labels = append(labels, Label{Name: l.GetName(), Value: l.GetValue()})
+				}
+				labels = append(labels, extra...)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+				series = append(series, TimeSeries{Labels: labels, Value: v, Timestamp: ts})
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), Label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), Label{"le", "+Inf"})
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), Label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest returns the series as a WriteRequest protobuf message, from
+// prometheus/prompb: every series is a TimeSeries of a single Sample.
+func encodeWriteRequest(series []TimeSeries) []byte {
+	req := proto.NewBuffer(nil)
+	for _, s := range series {
+		ts := proto.NewBuffer(nil)
+		for _, l := range s.Labels {
+			label := proto.NewBuffer(nil)
+			label.EncodeVarint(1<<3 | proto.WireBytes)
+			label.EncodeStringBytes(l.Name)
+			label.EncodeVarint(2<<3 | proto.WireBytes)
+			label.EncodeStringBytes(l.Value)
+
+			ts.EncodeVarint(1<<3 | proto.WireBytes)
+			ts.EncodeRawBytes(label.Bytes())
+		}
+		sample := proto.NewBuffer(nil)
+		sample.EncodeVarint(1<<3 | proto.WireFixed64)
+		sample.EncodeFixed64(math.Float64bits(s.Value))
+		sample.EncodeVarint(2<<3 | proto.WireVarint)
+		sample.EncodeVarint(uint64(s.Timestamp.UnixNano() / int64(time.Millisecond)))
+		ts.EncodeVarint(2<<3 | proto.WireBytes)
+		ts.EncodeRawBytes(sample.Bytes())
+
+		req.EncodeVarint(1<<3 | proto.WireBytes)
+		req.EncodeRawBytes(ts.Bytes())
+	}
+	return req.Bytes()
+}
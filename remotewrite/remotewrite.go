@@ -0,0 +1,316 @@
+// Package remotewrite sends metrics gathered from prometheus collectors to a prometheus
+// remote-write endpoint, for exporters which prometheus can't scrape.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults used by a zero Client and Queue.
+const (
+	DefaultMaxRetries      = 10
+	DefaultMinBackoff      = 500 * time.Millisecond
+	DefaultMaxBackoff      = 30 * time.Second
+	DefaultCapacity        = 100
+	DefaultMaxSamplesBatch = 2000
+)
+
+// StaleNaN is the bit pattern of the NaN value which marks a series as stale, as
+// prometheus does when a series disappears between scrapes.
+const StaleNaN uint64 = 0x7ff0000000000002
+
+// IsStaleNaN returns whether v is a staleness marker.
+func IsStaleNaN(v float64) bool {
+	return math.Float64bits(v) == StaleNaN
+}
+
+// Reasons samples are dropped by a queue.
+const (
+	// DropQueueFull drops the oldest samples queued, to queue new ones once the queue is
+	// full.
+	DropQueueFull = "queue_full"
+
+	// DropFailed drops samples whose request failed.
+	DropFailed = "failed"
+)
+
+// Client sends samples to a remote-write endpoint, retrying requests which fail with a
+// transport error, a 5xx status, or 429.
+type Client struct {
+	// URL is the remote-write endpoint, such as http://prometheus:9090/api/v1/write.
+	URL string
+
+	// Username and Password, if set, authenticate requests with basic auth, and
+	// BearerToken with a bearer token.
+	Username    string
+	Password    string
+	BearerToken string
+
+	// HTTPClient sends the requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// MaxRetries is the number of times a request is retried. Zero means
+	// DefaultMaxRetries, and a negative value disables retries.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the time between attempts, which doubles after each
+	// attempt. They default to DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// recoverable is an error of a request which may succeed if retried.
+type recoverable struct {
+	error
+}
+
+// Send sends the series in a single request, retrying it until it succeeds, fails with an
+// error which can't be recovered from, runs out of retries, or ctx is done.
+func (c *Client) Send(ctx context.Context, series []TimeSeries) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	retries := c.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, body)
+		if _, ok := err.(recoverable); !ok || attempt >= retries {
+			return err
+		}
+
+		timer := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "kafka-connect-exporter")
+	switch {
+	case c.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return recoverable{err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	err = errors.Errorf("writing to %s: unexpected status %d: %s", c.URL, res.StatusCode, strings.TrimSpace(string(msg)))
+	if res.StatusCode/100 == 5 || res.StatusCode == http.StatusTooManyRequests {
+		return recoverable{err}
+	}
+	return err
+}
+
+// backoff returns the time to wait after the given attempt, starting at 0: a random
+// duration between half and all of the exponential backoff.
+func (c *Client) backoff(attempt int) time.Duration {
+	min, max := c.MinBackoff, c.MaxBackoff
+	if min == 0 {
+		min = DefaultMinBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Queue queues the samples gathered after each collection, and sends them in order with
+// its client, batching those queued while a request was in flight. Once the queue is full,
+// for example while the endpoint is down, the oldest samples are dropped.
+//
+// A series queued from a gatherer, but no longer gathered from it, is ended with a
+// staleness marker, so that the remote storage doesn't keep it for its lookback window.
+type Queue struct {
+	client   *Client
+	capacity int
+
+	// MaxSamplesBatch caps the number of samples sent in a single request, unless a single
+	// collection has more. It defaults to DefaultMaxSamplesBatch.
+	MaxSamplesBatch int
+
+	// OnError, if set, is called with the errors of requests which failed, and of samples
+	// dropped.
+	OnError func(err error)
+
+	// OnDrop, if set, is called with the number of samples dropped, and the reason, which
+	// is DropQueueFull or DropFailed.
+	OnDrop func(reason string, samples int)
+
+	mu      sync.Mutex
+	batches [][]TimeSeries
+	ready   chan struct{}
+
+	// queued is the labels of the series last queued from each gatherer, by their key.
+	queued map[prom.Gatherer]map[string][]Label
+}
+
+// NewQueue returns a queue sending with client, holding the samples of up to capacity
+// collections. A capacity of zero means DefaultCapacity.
+func NewQueue(client *Client, capacity int) *Queue {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Queue{
+		client:   client,
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+		queued:   make(map[prom.Gatherer]map[string][]Label),
+	}
+}
+
+// Enqueue queues the samples of the metrics gathered from g, and staleness markers for the
+// series queued from g last time which are gone, without waiting for them to be sent.
+// Gatherers are told apart by identity, so g must be comparable, such as a
+// *prometheus.Registry.
+func (q *Queue) Enqueue(g prom.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return errors.Wrap(err, "gathering metrics")
+	}
+	now := time.Now()
+	series := Series(mfs, now)
+	queued := make(map[string][]Label, len(series))
+	for _, s := range series {
+		queued[key(s.Labels)] = s.Labels
+	}
+
+	q.mu.Lock()
+	for k, labels := range q.queued[g] {
+		if _, ok := queued[k]; !ok {
+			series = append(series, TimeSeries{Labels: labels, Value: math.Float64frombits(StaleNaN), Timestamp: now})
+		}
+	}
+	q.queued[g] = queued
+	if len(series) == 0 {
+		q.mu.Unlock()
+		return nil
+	}
+	var dropped int
+	if len(q.batches) >= q.capacity {
+		dropped = len(q.batches[0])
+		q.batches = q.batches[1:]
+	}
+	q.batches = append(q.batches, series)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	if dropped > 0 {
+		q.drop(DropQueueFull, dropped)
+		q.error(errors.Errorf("remote-write queue full, dropped %d samples", dropped))
+	}
+	return nil
+}
+
+// Run sends the queued samples until ctx is done. Samples still queued then are dropped.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		series := q.next()
+		if series == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.ready:
+				continue
+			}
+		}
+		if err := q.client.Send(ctx, series); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			q.drop(DropFailed, len(series))
+			q.error(errors.Wrapf(err, "dropped %d samples", len(series)))
+		}
+	}
+}
+
+// next dequeues the oldest batches, up to MaxSamplesBatch samples, or nil if the queue is
+// empty.
+func (q *Queue) next() []TimeSeries {
+	max := q.MaxSamplesBatch
+	if max <= 0 {
+		max = DefaultMaxSamplesBatch
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var series []TimeSeries
+	for len(q.batches) > 0 && (series == nil || len(series)+len(q.batches[0]) <= max) {
+		series = append(series, q.batches[0]...)
+		q.batches = q.batches[1:]
+	}
+	return series
+}
+
+func (q *Queue) error(err error) {
+	if q.OnError != nil {
+		q.OnError(err)
+	}
+}
+
+func (q *Queue) drop(reason string, samples int) {
+	if q.OnDrop != nil {
+		q.OnDrop(reason, samples)
+	}
+}
+
+// key returns a string identifying a series by its labels, which are sorted by name.
+func key(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0xff)
+		b.WriteString(l.Value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
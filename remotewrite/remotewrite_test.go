@@ -0,0 +1,320 @@
+package remotewrite_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/remotewrite"
+	"github.com/golang/snappy"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// fields decodes the length delimited, fixed64 and varint fields of a protobuf message,
+// by field number. It panics if the message is malformed, which fails the request to the
+// receiver.
+func fields(b []byte) map[int][][]byte {
+	fs := make(map[int][][]byte)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		var v []byte
+		switch tag & 7 {
+		case 0:
+			_, n = binary.Uvarint(b)
+			v, b = b[:n], b[n:]
+		case 1:
+			v, b = b[:8], b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			v, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			panic(fmt.Sprintf("unexpected wire type %d", tag&7))
+		}
+		fs[int(tag>>3)] = append(fs[int(tag>>3)], v)
+	}
+	return fs
+}
+
+// decodeWriteRequest returns the samples of a WriteRequest, formatted as name{labels} value.
+func decodeWriteRequest(body []byte) []string {
+	var samples []string
+	for _, ts := range fields(body)[1] {
+		f := fields(ts)
+		var name string
+		var labels []string
+		for _, l := range f[1] {
+			lf := fields(l)
+			if string(lf[1][0]) == "__name__" {
+				name = string(lf[2][0])
+				continue
+			}
+			labels = append(labels, fmt.Sprintf("%s=%q", lf[1][0], lf[2][0]))
+		}
+		sample := fields(f[2][0])
+		value := fmt.Sprintf("%g", math.Float64frombits(binary.LittleEndian.Uint64(sample[1][0])))
+		if binary.LittleEndian.Uint64(sample[1][0]) == remotewrite.StaleNaN {
+			value = "stale"
+		}
+		samples = append(samples, fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), value))
+	}
+	return samples
+}
+
+// receiver is a remote-write endpoint, which records the samples of the requests it
+// receives, failing the first ones with the given status codes.
+type receiver struct {
+	mu       sync.Mutex
+	requests []http.Header
+	samples  [][]string
+	failures []int
+	received chan struct{}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	data, err := snappy.Decode(nil, body)
+	if err != nil || r.Header.Get("Content-Encoding") != "snappy" {
+		http.Error(w, "invalid snappy body", http.StatusBadRequest)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r.Header)
+	if len(rc.failures) > 0 {
+		status := rc.failures[0]
+		rc.failures = rc.failures[1:]
+		http.Error(w, "failed", status)
+		return
+	}
+	rc.samples = append(rc.samples, decodeWriteRequest(data))
+	if rc.received != nil {
+		rc.received <- struct{}{}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func gauge(value float64) prom.Gatherer {
+	reg := prom.NewRegistry()
+	tasks := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_tasks", Help: "tasks"}, []string{"state", "connector"})
+	tasks.WithLabelValues("RUNNING", "orders").Set(value)
+	reg.MustRegister(tasks)
+	return reg
+}
+
+type sendTestCase struct {
+	name     string
+	client   remotewrite.Client
+	failures []int
+	auth     string
+	requests int
+	err      bool
+}
+
+func TestClientSend(t *testing.T) {
+	testCases := []sendTestCase{
+		{
+			name:     "basic auth",
+			client:   remotewrite.Client{Username: "user", Password: "secret"},
+			auth:     "Basic dXNlcjpzZWNyZXQ=",
+			requests: 1,
+		},
+		{
+			name:     "bearer token, retried on 5xx",
+			client:   remotewrite.Client{BearerToken: "token"},
+			failures: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			auth:     "Bearer token",
+			requests: 4,
+		},
+		{
+			name:     "not retried on 4xx",
+			failures: []int{http.StatusBadRequest},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:     "out of retries",
+			client:   remotewrite.Client{MaxRetries: 2},
+			failures: []int{500, 500, 500, 500},
+			requests: 3,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc sendTestCase) assert(t *testing.T) {
+	rc := &receiver{failures: tc.failures}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	tc.client.URL = srv.URL
+	tc.client.MinBackoff, tc.client.MaxBackoff = time.Millisecond, time.Millisecond
+	now := time.Now()
+	err := tc.client.Send(context.Background(), []remotewrite.TimeSeries{{
+		Labels:    []remotewrite.Label{{Name: "__name__", Value: "kafka_connect_up"}, {Name: "cluster", Value: "edge"}},
+		Value:     1,
+		Timestamp: now,
+	}})
+	if tc.err != (err != nil) {
+		t.Fatalf("expected error %t, got %v", tc.err, err)
+	}
+	if len(rc.requests) != tc.requests {
+		t.Fatalf("expected %d requests, got %d", tc.requests, len(rc.requests))
+	}
+	if auth := rc.requests[0].Get("Authorization"); auth != tc.auth {
+		t.Errorf("expected authorization %q, got %q", tc.auth, auth)
+	}
+	if !tc.err && !reflect.DeepEqual(rc.samples, [][]string{{`kafka_connect_up{cluster="edge"} 1`}}) {
+		t.Errorf("unexpected samples %q", rc.samples)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	rc := &receiver{received: make(chan struct{}, 1)}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	var errs []string
+	dropped := make(map[string]int)
+	q := remotewrite.NewQueue(&remotewrite.Client{URL: srv.URL}, 2)
+	q.OnError = func(err error) {
+		errs = append(errs, err.Error())
+	}
+	q.OnDrop = func(reason string, samples int) {
+		dropped[reason] += samples
+	}
+
+	// the oldest collection is dropped once the queue is full, and the others are sent in
+	// a single request.
+	for i := 1; i <= 3; i++ {
+		if err := q.Enqueue(gauge(float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(errs, []string{"remote-write queue full, dropped 1 samples"}) {
+		t.Errorf("expected the oldest samples to be dropped, got %q", errs)
+	}
+	if expect := map[string]int{remotewrite.DropQueueFull: 1}; !reflect.DeepEqual(dropped, expect) {
+		t.Errorf("expected drops %v, got %v", expect, dropped)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-rc.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for samples")
+	}
+	cancel()
+	<-done
+
+	expect := [][]string{{
+		`kafka_connect_tasks{connector="orders",state="RUNNING"} 2`,
+		`kafka_connect_tasks{connector="orders",state="RUNNING"} 3`,
+	}}
+	if !reflect.DeepEqual(rc.samples, expect) {
+		t.Errorf("expected %q, got %q", expect, rc.samples)
+	}
+}
+
+func TestQueueStale(t *testing.T) {
+	rc := &receiver{received: make(chan struct{}, 1)}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	q := remotewrite.NewQueue(&remotewrite.Client{URL: srv.URL}, 0)
+
+	reg := prom.NewRegistry()
+	tasks := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_tasks", Help: "tasks"}, []string{"state", "connector"})
+	reg.MustRegister(tasks)
+	tasks.WithLabelValues("RUNNING", "orders").Set(1)
+	if err := q.Enqueue(reg); err != nil {
+		t.Fatal(err)
+	}
+	// the task fails: its RUNNING series is ended once.
+	tasks.Reset()
+	tasks.WithLabelValues("FAILED", "orders").Set(1)
+	for i := 0; i < 2; i++ {
+		if err := q.Enqueue(reg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// series of other gatherers aren't ended.
+	if err := q.Enqueue(gauge(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-rc.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for samples")
+	}
+	cancel()
+	<-done
+
+	expect := [][]string{{
+		`kafka_connect_tasks{connector="orders",state="RUNNING"} 1`,
+		`kafka_connect_tasks{connector="orders",state="FAILED"} 1`,
+		`kafka_connect_tasks{connector="orders",state="RUNNING"} stale`,
+		`kafka_connect_tasks{connector="orders",state="FAILED"} 1`,
+		`kafka_connect_tasks{connector="orders",state="RUNNING"} 2`,
+	}}
+	if !reflect.DeepEqual(rc.samples, expect) {
+		t.Errorf("expected %q, got %q", expect, rc.samples)
+	}
+}
+
+func TestSeriesHistogram(t *testing.T) {
+	reg := prom.NewRegistry()
+	h := prom.NewHistogram(prom.HistogramOpts{Name: "duration_seconds", Help: "duration", Buckets: []float64{0.5}})
+	h.Observe(0.25)
+	h.Observe(1)
+	reg.MustRegister(h)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, s := range remotewrite.Series(mfs, time.Now()) {
+		var labels []string
+		for _, l := range s.Labels {
+			labels = append(labels, l.Name+"="+l.Value)
+		}
+		got = append(got, fmt.Sprintf("%s %g", strings.Join(labels, ","), s.Value))
+	}
+	sort.Strings(got)
+	expect := []string{
+		"__name__=duration_seconds_bucket,le=+Inf 2",
+		"__name__=duration_seconds_bucket,le=0.5 1",
+		"__name__=duration_seconds_count 2",
+		"__name__=duration_seconds_sum 1.25",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
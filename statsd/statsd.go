@@ -0,0 +1,236 @@
+// Package statsd emits the gauges gathered from prometheus collectors to a StatsD server,
+// such as a Datadog agent, with their labels as DogStatsD tags.
+package statsd
+
+import (
+	"math"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// unixScheme prefixes the addresses of unix datagram sockets.
+const unixScheme = "unix://"
+
+// Maximum sizes of the packets sent, which hold as many metrics as fit: the largest UDP
+// payload which isn't fragmented on common networks, and the default buffer of the
+// Datadog agent's unix socket.
+const (
+	maxUDPPacketSize  = 1432
+	maxUnixPacketSize = 8192
+)
+
+// ParseAddress returns the network and address of a StatsD server address, which is
+// "unixgram" and the path of the socket for unix:///path, and "udp" and host:port
+// otherwise.
+func ParseAddress(addr string) (network, address string, err error) {
+	if strings.HasPrefix(addr, unixScheme) {
+		path := strings.TrimPrefix(addr, unixScheme)
+		if !filepath.IsAbs(path) {
+			return "", "", errors.Errorf("%q is not an absolute socket path, expected unix:///path", addr)
+		}
+		return "unixgram", path, nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", err
+	}
+	return "udp", addr, nil
+}
+
+// Emitter sends gauges to a StatsD server. The connection is opened on the first emit,
+// and opened again after a failed one, so that the server may be restarted.
+type Emitter struct {
+	network string
+	address string
+	size    int
+
+	// Prefix is prepended to the metric names, followed by a dot.
+	Prefix string
+
+	// Tags sends labels as DogStatsD tags. Otherwise the label values are appended to the
+	// metric names, for servers which don't support tags.
+	Tags bool
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	// sent is the set of series last sent from each gatherer.
+	sent map[prom.Gatherer]map[series]bool
+}
+
+// NewEmitter returns an emitter to the server at addr, as parsed by ParseAddress, which
+// sends labels as tags.
+func NewEmitter(addr string) (*Emitter, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	size := maxUDPPacketSize
+	if network == "unixgram" {
+		size = maxUnixPacketSize
+	}
+	return &Emitter{
+		network: network,
+		address: address,
+		size:    size,
+		Tags:    true,
+		sent:    make(map[prom.Gatherer]map[series]bool),
+	}, nil
+}
+
+// Emit sends the gauges and untyped metrics gathered from each gatherer. Other types are
+// skipped. As StatsD gauges keep their last value, a series sent by the last emit of a
+// gatherer, but no longer gathered from it, is sent once as 0. Gatherers are told apart by
+// identity, so they must be comparable, such as a *prometheus.Registry.
+func (e *Emitter) Emit(gatherers ...prom.Gatherer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var lines []string
+	sent := make(map[prom.Gatherer]map[series]bool, len(gatherers))
+	for _, g := range gatherers {
+		mfs, err := g.Gather()
+		if err != nil {
+			return errors.Wrap(err, "gathering metrics")
+		}
+		gathered := make(map[series]bool)
+		for _, mf := range mfs {
+			for _, smp := range e.format(mf) {
+				gathered[smp.series] = true
+				lines = append(lines, smp.line())
+			}
+		}
+		for s := range e.sent[g] {
+			if !gathered[s] {
+				lines = append(lines, sample{s, 0}.line())
+			}
+		}
+		sent[g] = gathered
+	}
+
+	if e.conn == nil {
+		conn, err := net.Dial(e.network, e.address)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+	for _, packet := range packets(lines, e.size) {
+		if _, err := e.conn.Write(packet); err != nil {
+			e.conn.Close()
+			e.conn = nil
+			return err
+		}
+	}
+	for g, gathered := range sent {
+		e.sent[g] = gathered
+	}
+	return nil
+}
+
+// Close closes the connection to the server, if open.
+func (e *Emitter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// series identifies a StatsD gauge: its name, and its tags, if any, as "|#tag,...".
+type series struct {
+	name string
+	tags string
+}
+
+// sample is the value of a series.
+type sample struct {
+	series
+	value float64
+}
+
+// line returns the StatsD line of the sample.
+func (s sample) line() string {
+	return s.name + ":" + strconv.FormatFloat(s.value, 'f', -1, 64) + "|g" + s.tags
+}
+
+// format returns the samples of the metric family. Labels with empty values are skipped,
+// as in prometheus.
+func (e *Emitter) format(mf *dto.MetricFamily) []sample {
+	switch mf.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+	default:
+		return nil
+	}
+
+	var samples []sample
+	for _, m := range mf.GetMetric() {
+		v := m.GetGauge().GetValue()
+		if mf.GetType() == dto.MetricType_UNTYPED {
+			v = m.GetUntyped().GetValue()
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+
+		name := mf.GetName()
+		if e.Prefix != "" {
+			name = strings.TrimSuffix(e.Prefix, ".") + "." + name
+		}
+		var tags []string
+		for _, l := range m.GetLabel() {
+			if l.GetValue() == "" {
+				continue
+			}
+			if e.Tags {
+				tags = append(tags, l.GetName()+":"+tagReplacer.Replace(l.GetValue()))
+			} else {
+				name += "." + invalidSegment.ReplaceAllString(l.GetValue(), "_")
+			}
+		}
+		s := series{name: name}
+		if len(tags) > 0 {
+			s.tags = "|#" + strings.Join(tags, ",")
+		}
+		samples = append(samples, sample{s, v})
+	}
+	return samples
+}
+
+// tagReplacer replaces the characters separating the parts of DogStatsD lines in tag
+// values.
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// invalidSegment matches the characters replaced in label values appended to names.
+var invalidSegment = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// packets joins the lines into packets of at most size bytes, separated by newlines. Lines
+// longer than size are sent in packets of their own.
+func packets(lines []string, size int) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > size {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
@@ -0,0 +1,212 @@
+package statsd_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/statsd"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func registry() *prom.Registry {
+	reg := prom.NewRegistry()
+	tasks := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_tasks", Help: "tasks"}, []string{"connector", "state"})
+	tasks.WithLabelValues("orders", "RUNNING").Set(2)
+	tasks.WithLabelValues("users,v2", "FAILED").Set(1)
+	info := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_connector_info", Help: "info"}, []string{"connector", "version", "type"})
+	info.WithLabelValues("orders", "", "sink").Set(1)
+	up := prom.NewGauge(prom.GaugeOpts{Name: "kafka_connect_up", Help: "up"})
+	up.Set(1)
+	retries := prom.NewCounter(prom.CounterOpts{Name: "kafka_connect_exporter_api_retries_total", Help: "retries"})
+	retries.Inc()
+	reg.MustRegister(tasks, info, up, retries)
+	return reg
+}
+
+// receive returns the lines of the packets received on conn, until none is received for
+// a short while.
+func receive(t *testing.T, conn net.PacketConn) (lines []string, packets int) {
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				sort.Strings(lines)
+				return lines, packets
+			}
+			t.Fatal(err)
+		}
+		packets++
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+type emitTestCase struct {
+	name   string
+	prefix string
+	tags   bool
+	expect []string
+}
+
+func TestEmitterEmit(t *testing.T) {
+	testCases := []emitTestCase{
+		{
+			name: "dogstatsd tags",
+			tags: true,
+			expect: []string{
+				"kafka_connect_connector_info:1|g|#connector:orders,type:sink",
+				"kafka_connect_tasks:1|g|#connector:users_v2,state:FAILED",
+				"kafka_connect_tasks:2|g|#connector:orders,state:RUNNING",
+				"kafka_connect_up:1|g",
+			},
+		},
+		{
+			name:   "prefix without tags",
+			prefix: "team.",
+			expect: []string{
+				"team.kafka_connect_connector_info.orders.sink:1|g",
+				"team.kafka_connect_tasks.orders.RUNNING:2|g",
+				"team.kafka_connect_tasks.users_v2.FAILED:1|g",
+				"team.kafka_connect_up:1|g",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc emitTestCase) assert(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := statsd.NewEmitter(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.Prefix = tc.prefix
+	e.Tags = tc.tags
+	if err := e.Emit(registry()); err != nil {
+		t.Fatal(err)
+	}
+	lines, _ := receive(t, conn)
+	if strings.Join(lines, "\n") != strings.Join(tc.expect, "\n") {
+		t.Errorf("unexpected lines:\nexpected: %q\ngot:      %q", tc.expect, lines)
+	}
+}
+
+func TestEmitterEmitGone(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	e, err := statsd.NewEmitter(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	reg := prom.NewRegistry()
+	state := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_state", Help: "state"}, []string{"connector", "state"})
+	reg.MustRegister(state)
+	other := prom.NewRegistry()
+	other.MustRegister(prom.NewGauge(prom.GaugeOpts{Name: "kafka_connect_up", Help: "up"}))
+
+	expects := [][]string{
+		{"kafka_connect_state:1|g|#connector:orders,state:RUNNING"},
+		{"kafka_connect_state:0|g|#connector:orders,state:RUNNING", "kafka_connect_state:1|g|#connector:orders,state:FAILED"},
+		{"kafka_connect_state:1|g|#connector:orders,state:FAILED"},
+	}
+	state.WithLabelValues("orders", "RUNNING").Set(1)
+	for i, expect := range expects {
+		if i == 1 {
+			state.DeleteLabelValues("orders", "RUNNING")
+			state.WithLabelValues("orders", "FAILED").Set(1)
+		}
+		if err := e.Emit(reg); err != nil {
+			t.Fatal(err)
+		}
+		// series of other gatherers aren't sent as gone.
+		if err := e.Emit(other); err != nil {
+			t.Fatal(err)
+		}
+		expect = append(expect, "kafka_connect_up:0|g")
+		sort.Strings(expect)
+		if lines, _ := receive(t, conn); strings.Join(lines, "\n") != strings.Join(expect, "\n") {
+			t.Errorf("emit %d: unexpected lines:\nexpected: %q\ngot:      %q", i, expect, lines)
+		}
+	}
+}
+
+func TestEmitterUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dsd.socket")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := statsd.NewEmitter("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	// enough connectors to need several packets, even on a unix socket.
+	reg := prom.NewRegistry()
+	tasks := prom.NewGaugeVec(prom.GaugeOpts{Name: "kafka_connect_tasks", Help: "tasks"}, []string{"connector"})
+	for i := 0; i < 500; i++ {
+		tasks.WithLabelValues(fmt.Sprintf("connector-%03d", i)).Set(1)
+	}
+	reg.MustRegister(tasks)
+
+	if err := e.Emit(reg); err != nil {
+		t.Fatal(err)
+	}
+	lines, packets := receive(t, conn)
+	if len(lines) != 500 {
+		t.Errorf("expected 500 lines, got %d", len(lines))
+	}
+	if packets < 2 {
+		t.Errorf("expected several packets, got %d", packets)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	for addr, expect := range map[string]string{
+		"localhost:8125":                     "udp localhost:8125",
+		"unix:///var/run/datadog/dsd.socket": "unixgram /var/run/datadog/dsd.socket",
+	} {
+		network, address, err := statsd.ParseAddress(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := network + " " + address; got != expect {
+			t.Errorf("expected %s, got %s", expect, got)
+		}
+	}
+	for _, invalid := range []string{"localhost", "unix://dsd.socket"} {
+		if _, _, err := statsd.ParseAddress(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package status renders an HTML overview of the monitored kafka connect clusters, for
+// engineers on call. The page is rendered from the snapshots of the clusters' last
+// collection, refreshes itself, and needs no javascript.
+package status
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+// severity orders states from the most to the least in need of attention. Unknown states
+// come after FAILED.
+var severity = map[string]int{
+	connectapi.StateFailed:     0,
+	connectapi.StateUnassigned: 2,
+	connectapi.StateRestarting: 3,
+	connectapi.StatePaused:     4,
+	connectapi.StateStopped:    5,
+	connectapi.StateRunning:    6,
+}
+
+func rank(state string) int {
+	if r, ok := severity[state]; ok {
+		return r
+	}
+	return 1
+}
+
+// page is the data the page template is rendered with.
+type page struct {
+	Refresh  int
+	Now      time.Time
+	Clusters []cluster
+}
+
+type cluster struct {
+	Name        string
+	CollectedAt time.Time
+	Age         time.Duration
+	Failing     bool
+	Stale       bool
+	Truncated   bool
+	Connectors  int
+	Groups      []group
+	Workers     []worker
+}
+
+// group is the connectors whose most severe state, of the connector and its tasks, is
+// State.
+type group struct {
+	State      string
+	Connectors []prometheus.ConnectorSnapshot
+}
+
+// worker is the tasks running on a worker, counted by state, and the connectors they
+// belong to.
+type worker struct {
+	ID     string
+	States []count
+	Tasks  []string
+}
+
+type count struct {
+	State string
+	N     int
+}
+
+// ServePage renders the status page of the clusters. If refresh is positive, the page
+// reloads itself after that long, which can be overridden with the refresh query
+// parameter, in seconds. A refresh of 0 disables it.
+func ServePage(w http.ResponseWriter, r *http.Request, clusters []api.Cluster, refresh time.Duration) {
+	p := page{Refresh: int(refresh.Seconds()), Now: time.Now()}
+	if s := r.URL.Query().Get("refresh"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "refresh must be a number of seconds", http.StatusBadRequest)
+			return
+		}
+		p.Refresh = n
+	}
+	for _, c := range clusters {
+		p.Clusters = append(p.Clusters, newCluster(c, p.Now))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func newCluster(c api.Cluster, now time.Time) cluster {
+	snap := c.Snapshot
+	view := cluster{
+		Name:        c.Name,
+		CollectedAt: snap.CollectedAt,
+		Failing:     snap.Failing,
+		Stale:       snap.Stale,
+		Truncated:   snap.Truncated,
+		Connectors:  len(snap.Connectors),
+	}
+	if !snap.CollectedAt.IsZero() {
+		view.Age = now.Sub(snap.CollectedAt).Truncate(time.Second)
+	}
+
+	groups := make(map[string][]prometheus.ConnectorSnapshot)
+	workers := make(map[string]map[string]int)
+	tasks := make(map[string][]string)
+	for _, conn := range snap.Connectors {
+		state := conn.State
+		for _, t := range conn.Tasks {
+			if rank(t.State) < rank(state) {
+				state = t.State
+			}
+			if workers[t.WorkerID] == nil {
+				workers[t.WorkerID] = make(map[string]int)
+			}
+			workers[t.WorkerID][t.State]++
+			tasks[t.WorkerID] = append(tasks[t.WorkerID], conn.Name+"/"+strconv.Itoa(t.ID))
+		}
+		groups[state] = append(groups[state], conn)
+	}
+
+	for state, conns := range groups {
+		view.Groups = append(view.Groups, group{state, conns})
+	}
+	sort.Slice(view.Groups, func(i, j int) bool {
+		a, b := view.Groups[i].State, view.Groups[j].State
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		return a < b
+	})
+
+	for id, states := range workers {
+		w := worker{ID: id, Tasks: tasks[id]}
+		for state, n := range states {
+			w.States = append(w.States, count{state, n})
+		}
+		sort.Slice(w.States, func(i, j int) bool { return rank(w.States[i].State) < rank(w.States[j].State) })
+		view.Workers = append(view.Workers, w)
+	}
+	sort.Slice(view.Workers, func(i, j int) bool { return view.Workers[i].ID < view.Workers[j].ID })
+	return view
+}
+
+var pageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{- if .Refresh}}
+<meta http-equiv="refresh" content="{{.Refresh}}">
+{{- end}}
+<title>Kafka Connect Exporter</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { text-align: left; padding: 0.2em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+pre { white-space: pre-wrap; font-size: 0.85em; background: #f6f6f6; padding: 0.5em; }
+.state { font-weight: bold; }
+.FAILED, .failing { color: #c00; }
+.UNASSIGNED, .RESTARTING, .PAUSED, .STOPPED, .stale, .truncated { color: #b60; }
+.RUNNING, .ok { color: #070; }
+</style>
+</head>
+<body>
+<h1>Kafka Connect Exporter</h1>
+<p>Rendered at {{time .Now}}{{if .Refresh}}, refreshed every {{.Refresh}}s{{end}}.</p>
+{{- range .Clusters}}
+<h2>{{if .Name}}{{.Name}}{{else}}cluster{{end}}</h2>
+<p>
+{{- if .CollectedAt.IsZero}}
+<span class="failing">Not collected yet.</span>
+{{- else}}
+Collected at {{time .CollectedAt}}, {{.Age}} ago:
+{{- if .Stale}} <span class="stale">stale, kafka connect can't be reached.</span>
+{{- else if .Failing}} <span class="failing">failing, serving the last snapshot.</span>
+{{- else if .Truncated}} <span class="truncated">truncated by the scrape deadline.</span>
+{{- else}} <span class="ok">OK.</span>
+{{- end}} {{.Connectors}} connectors.
+{{- end}}
+</p>
+{{- range .Groups}}
+<h3 class="{{.State}}">{{.State}} ({{len .Connectors}})</h3>
+<table>
+<tr><th>Connector</th><th>State</th><th>Worker</th><th>Tasks</th><th>Owner</th></tr>
+{{- range .Connectors}}
+<tr>
+<td>{{.Name}}{{with .Metadata}}{{with .RunbookURL}} (<a href="{{.}}">runbook</a>){{end}}{{end}}</td>
+<td class="state {{.State}}">{{.State}}</td>
+<td>{{.WorkerID}}</td>
+<td>
+{{- range .Tasks}}<span class="{{.State}}" title="{{.WorkerID}} since {{time .Since}}">{{.ID}}:{{.State}}</span> {{end}}
+{{- with .Trace}}
+<details><summary>connector trace</summary><pre>{{.}}</pre></details>
+{{- end}}
+{{- range .Tasks}}{{if .Trace}}
+<details><summary>task {{.ID}} trace</summary><pre>{{.Trace}}</pre></details>
+{{- end}}{{end}}
+</td>
+<td>{{with .Metadata}}{{.Owner}}{{with .SlackChannel}} ({{.}}){{end}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Workers}}
+<h3>Workers</h3>
+<table>
+<tr><th>Worker</th><th>Tasks</th><th>Connectors</th></tr>
+{{- range .Workers}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{range .States}}<span class="{{.State}}">{{.N}} {{.State}}</span> {{end}}</td>
+<td><details><summary>{{len .Tasks}} tasks</summary>{{range .Tasks}}{{.}}<br>{{end}}</details></td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+<p>
+<a href="/metrics">Metrics</a> |
+<a href="/api/v1/clusters">Clusters</a> |
+<a href="/api/v1/connectors">Connectors</a> |
+<a href="/-/healthy">Health</a> |
+<a href="/-/ready">Readiness</a> |
+<a href="/config">Config</a>
+</p>
+</body>
+</html>
+`))
@@ -0,0 +1,90 @@
+package status_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/status"
+)
+
+func testClusters() []api.Cluster {
+	return []api.Cluster{
+		{
+			Name: "prod",
+			Snapshot: prometheus.Snapshot{
+				CollectedAt: time.Now(),
+				Connectors: []prometheus.ConnectorSnapshot{
+					{
+						Name:     "orders",
+						State:    "RUNNING",
+						WorkerID: "w1:8083",
+						Tasks: []prometheus.TaskSnapshot{
+							{ID: 0, State: "RUNNING", WorkerID: "w1:8083"},
+							{ID: 1, State: "FAILED", WorkerID: "w2:8083", Trace: "org.apache.kafka.connect.errors.ConnectException: <boom>"},
+						},
+					},
+					{
+						Name:     "users",
+						State:    "RUNNING",
+						WorkerID: "w2:8083",
+						Tasks:    []prometheus.TaskSnapshot{{ID: 0, State: "RUNNING", WorkerID: "w2:8083"}},
+					},
+				},
+			},
+		},
+		{
+			Name:     "staging",
+			Snapshot: prometheus.Snapshot{Failing: true},
+		},
+	}
+}
+
+func TestServePage(t *testing.T) {
+	rec := httptest.NewRecorder()
+	status.ServePage(rec, httptest.NewRequest("GET", "/", nil), testClusters(), 10*time.Second)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	body := rec.Body.String()
+
+	for _, expect := range []string{
+		`<meta http-equiv="refresh" content="10">`,
+		`<h2>prod</h2>`,
+		`<h2>staging</h2>`,
+		`Not collected yet.`,
+		// the connector with a failed task is grouped as failed, before the running one.
+		`<h3 class="FAILED">FAILED (1)</h3>`,
+		`<h3 class="RUNNING">RUNNING (1)</h3>`,
+		`<details><summary>task 1 trace</summary><pre>org.apache.kafka.connect.errors.ConnectException: &lt;boom&gt;</pre></details>`,
+		`<td>w2:8083</td>`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected page to contain %q:\n%s", expect, body)
+		}
+	}
+	if strings.Index(body, "FAILED (1)") > strings.Index(body, "RUNNING (1)") {
+		t.Error("expected failed connectors to be listed first")
+	}
+	if strings.Contains(body, "<script") {
+		t.Error("expected no javascript")
+	}
+}
+
+func TestServePageRefresh(t *testing.T) {
+	rec := httptest.NewRecorder()
+	status.ServePage(rec, httptest.NewRequest("GET", "/?refresh=0", nil), testClusters(), 10*time.Second)
+	if strings.Contains(rec.Body.String(), `http-equiv="refresh"`) {
+		t.Error("expected refresh to be disabled")
+	}
+
+	rec = httptest.NewRecorder()
+	status.ServePage(rec, httptest.NewRequest("GET", "/?refresh=soon", nil), testClusters(), 10*time.Second)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
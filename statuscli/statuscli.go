@@ -0,0 +1,191 @@
+// Package statuscli writes the status of the connectors of kafka connect clusters, for the
+// status subcommand: as a table, or as a JSON or YAML document for scripts.
+package statuscli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Format is an output format of Write.
+type Format string
+
+// Output formats.
+const (
+	// Table lists a connector per line, with the number of its tasks running.
+	Table Format = ""
+
+	// Wide lists a connector per line, followed by a line per task, with more columns.
+	Wide Format = "wide"
+
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// ParseFormat returns the format of the given name, which is empty for Table.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "table":
+		return Table, nil
+	case Table, Wide, JSON, YAML:
+		return f, nil
+	}
+	return "", errors.Errorf("unknown output format %q, expected table, wide, json or yaml", name)
+}
+
+// Filter selects the connectors written by Write. Empty fields match every connector.
+type Filter struct {
+	// States are matched against the states of the connector and each of its tasks.
+	States []string
+
+	// Name is matched against the connector name.
+	Name *regexp.Regexp
+}
+
+// Match reports whether the connector passes the filter.
+func (f Filter) Match(conn prometheus.ConnectorSnapshot) bool {
+	if f.Name != nil && !f.Name.MatchString(conn.Name) {
+		return false
+	}
+	if len(f.States) == 0 {
+		return true
+	}
+	for _, state := range f.States {
+		if strings.EqualFold(conn.State, state) {
+			return true
+		}
+		for _, t := range conn.Tasks {
+			if strings.EqualFold(t.State, state) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// connector is a connector as written in the JSON and YAML formats.
+type connector struct {
+	Cluster string `json:"cluster,omitempty"`
+	prometheus.ConnectorSnapshot
+}
+
+// Write writes the connectors of the clusters passing the filter to w, in the given
+// format. It returns whether any connector or task written has failed.
+func Write(w io.Writer, clusters []api.Cluster, f Filter, format Format) (failed bool, err error) {
+	var conns []connector
+	for _, c := range clusters {
+		for _, conn := range c.Snapshot.Connectors {
+			if !f.Match(conn) {
+				continue
+			}
+			conns = append(conns, connector{c.Name, conn})
+			failed = failed || hasFailed(conn)
+		}
+	}
+
+	switch format {
+	case JSON, YAML:
+		err = writeDocument(w, conns, format)
+	default:
+		err = writeTable(w, conns, format == Wide)
+	}
+	return failed, err
+}
+
+func hasFailed(conn prometheus.ConnectorSnapshot) bool {
+	if conn.State == connectapi.StateFailed {
+		return true
+	}
+	for _, t := range conn.Tasks {
+		if t.State == connectapi.StateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDocument writes the connectors as a JSON or YAML list. The YAML document is
+// converted from the JSON one, so that both have the same keys, in the same order.
+func writeDocument(w io.Writer, conns []connector, format Format) error {
+	if conns == nil {
+		conns = []connector{}
+	}
+	data, err := json.MarshalIndent(conns, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == JSON {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	var doc []yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if data, err = yaml.Marshal(doc); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func writeTable(w io.Writer, conns []connector, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if wide {
+		fmt.Fprintln(tw, "CLUSTER\tCONNECTOR\tTASK\tTYPE\tSTATE\tWORKER\tOWNER\tTRACE")
+	} else {
+		fmt.Fprintln(tw, "CLUSTER\tCONNECTOR\tSTATE\tTASKS\tWORKER")
+	}
+	for _, c := range conns {
+		cluster := c.Cluster
+		if cluster == "" {
+			cluster = "-"
+		}
+		if !wide {
+			var running int
+			for _, t := range c.Tasks {
+				if t.State == connectapi.StateRunning {
+					running++
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d/%d\t%s\n", cluster, c.Name, c.State, running, len(c.Tasks), c.WorkerID)
+			continue
+		}
+
+		var owner string
+		if c.Metadata != nil {
+			owner = c.Metadata.Owner
+		}
+		fmt.Fprintf(tw, "%s\t%s\t-\t%s\t%s\t%s\t%s\t%s\n", cluster, c.Name, dash(c.Type), c.State, c.WorkerID, dash(owner), firstLine(c.Trace))
+		for _, t := range c.Tasks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t\t%s\t%s\t\t%s\n", cluster, c.Name, strconv.Itoa(t.ID), t.State, t.WorkerID, firstLine(t.Trace))
+		}
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// firstLine returns the first line of a trace, which is "-" if it is empty.
+func firstLine(trace string) string {
+	if i := strings.IndexByte(trace, '\n'); i >= 0 {
+		trace = trace[:i]
+	}
+	return dash(strings.TrimSpace(trace))
+}
@@ -0,0 +1,144 @@
+package statuscli_test
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/statuscli"
+)
+
+func testClusters() []api.Cluster {
+	return []api.Cluster{
+		{
+			Name: "prod",
+			Snapshot: prometheus.Snapshot{
+				CollectedAt: time.Now(),
+				Connectors: []prometheus.ConnectorSnapshot{
+					{
+						Name:     "orders",
+						State:    "RUNNING",
+						WorkerID: "w1:8083",
+						Tasks: []prometheus.TaskSnapshot{
+							{ID: 0, State: "RUNNING", WorkerID: "w1:8083"},
+							{ID: 1, State: "FAILED", WorkerID: "w2:8083", Trace: "org.apache.kafka.connect.errors.ConnectException: <boom>"},
+						},
+					},
+					{
+						Name:     "users",
+						State:    "RUNNING",
+						WorkerID: "w2:8083",
+						Tasks:    []prometheus.TaskSnapshot{{ID: 0, State: "RUNNING", WorkerID: "w2:8083"}},
+					},
+				},
+			},
+		},
+		{
+			Name:     "staging",
+			Snapshot: prometheus.Snapshot{Failing: true},
+		},
+	}
+}
+
+type writeTestCase struct {
+	name         string
+	filter       statuscli.Filter
+	format       statuscli.Format
+	expect       []string
+	expectFailed bool
+}
+
+func TestWrite(t *testing.T) {
+	testCases := []writeTestCase{
+		{
+			name: "table",
+			expect: []string{
+				"CLUSTER  CONNECTOR  STATE    TASKS  WORKER",
+				"prod     orders     RUNNING  1/2    w1:8083",
+				"prod     users      RUNNING  1/1    w2:8083",
+			},
+			expectFailed: true,
+		},
+		{
+			name:   "filtered by state",
+			filter: statuscli.Filter{States: []string{"running"}, Name: regexp.MustCompile("^us")},
+			expect: []string{
+				"CLUSTER  CONNECTOR  STATE    TASKS  WORKER",
+				"prod     users      RUNNING  1/1    w2:8083",
+			},
+		},
+		{
+			name:   "wide",
+			filter: statuscli.Filter{States: []string{"FAILED"}},
+			format: statuscli.Wide,
+			expect: []string{
+				"CLUSTER  CONNECTOR  TASK  TYPE  STATE    WORKER   OWNER  TRACE",
+				"prod     orders     -     -     RUNNING  w1:8083  -      -",
+				"prod     orders     0           RUNNING  w1:8083         -",
+				"prod     orders     1           FAILED   w2:8083         org.apache.kafka.connect.errors.ConnectException: <boom>",
+			},
+			expectFailed: true,
+		},
+		{
+			name:   "yaml",
+			filter: statuscli.Filter{Name: regexp.MustCompile("^users$")},
+			format: statuscli.YAML,
+			expect: []string{
+				"- cluster: prod",
+				"  name: users",
+				"  state: RUNNING",
+				"  worker_id: w2:8083",
+				"  since: \"0001-01-01T00:00:00Z\"",
+				"  tasks:",
+				"  - id: 0",
+				"    state: RUNNING",
+				"    worker_id: w2:8083",
+				"    since: \"0001-01-01T00:00:00Z\"",
+			},
+		},
+		{
+			name:   "json without connectors",
+			filter: statuscli.Filter{States: []string{"PAUSED"}},
+			format: statuscli.JSON,
+			expect: []string{"[]"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc writeTestCase) assert(t *testing.T) {
+	var buf bytes.Buffer
+	failed, err := statuscli.Write(&buf, testClusters(), tc.filter, tc.format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != tc.expectFailed {
+		t.Errorf("expected failed to be %v", tc.expectFailed)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	if !reflect.DeepEqual(lines, tc.expect) {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, expect := range map[string]statuscli.Format{"": statuscli.Table, "table": statuscli.Table, "WIDE": statuscli.Wide, "json": statuscli.JSON, "yaml": statuscli.YAML} {
+		if f, err := statuscli.ParseFormat(name); err != nil || f != expect {
+			t.Errorf("expected %q for %q, got %q, %v", expect, name, f, err)
+		}
+	}
+	if _, err := statuscli.ParseFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/api"
+	"github.com/autotraderuk/kafka-connect-exporter/statuscli"
+)
+
+// Exit statuses of the status subcommand.
+const (
+	statusOK     = 0
+	statusFailed = 1
+	statusError  = 2
+)
+
+// runStatus runs the status subcommand: it collects every configured cluster once, and
+// prints their connectors in the format set by args. It returns statusFailed if any
+// connector or task printed has failed, and statusError if the flags are invalid or a
+// cluster can't be collected.
+func runStatus(args []string) int {
+	var states, clusters stringsFlag
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	loader := loaderFlags(flags)
+	timeout := flags.Duration("timeout", 30*time.Second, "time allowed for the collection")
+	output := flags.String("o", "table", "output format: table, wide, json or yaml")
+	name := flags.String("name", "", "regular expression connector names must match")
+	flags.Var(&states, "state", "state of the connector or any of its tasks, can be repeated")
+	flags.Var(&clusters, "cluster", "name of a cluster to show, can be repeated")
+	if err := flags.Parse(args); err != nil {
+		return statusError
+	}
+
+	format, err := statuscli.ParseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return statusError
+	}
+	filter := statuscli.Filter{States: states}
+	if *name != "" {
+		if filter.Name, err = regexp.Compile(*name); err != nil {
+			fmt.Fprintln(os.Stderr, "-name:", err)
+			return statusError
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	collected, err := collect(ctx, loader)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return statusError
+	}
+
+	code := statusOK
+	var shown []api.Cluster
+	for _, c := range collected {
+		if len(clusters) > 0 && !contains(clusters, c.Name) {
+			continue
+		}
+		if c.Err != nil {
+			fmt.Fprintf(os.Stderr, "cluster %s: %s\n", c.Name, c.Err)
+			code = statusError
+			continue
+		}
+		if c.Snapshot.Truncated {
+			fmt.Fprintf(os.Stderr, "cluster %s: only partially collected within %s\n", c.Name, *timeout)
+			code = statusError
+		}
+		shown = append(shown, api.Cluster{Name: c.Name, Snapshot: c.Snapshot})
+	}
+
+	failed, err := statuscli.Write(os.Stdout, shown, filter, format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return statusError
+	}
+	if failed && code == statusOK {
+		code = statusFailed
+	}
+	return code
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
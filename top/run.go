@@ -0,0 +1,113 @@
+package top
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Run shows the dashboard on the terminal of in and out until the user quits, or ctx is
+// done. The clusters are collected every interval, and actions time out after timeout.
+func Run(ctx context.Context, in, out *os.File, m *Model, interval, timeout time.Duration) error {
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer restore()
+	// switch to the alternate screen, and hide the cursor, until done.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(in, keys)
+
+	collected := make(chan map[*Cluster]error, 1)
+	collect := func() {
+		cctx, cancel := context.WithTimeout(ctx, interval+timeout)
+		defer cancel()
+		collected <- m.Collect(cctx)
+	}
+	go collect()
+
+	render := func() {
+		width, height := size(int(out.Fd()))
+		m.Render(out, width, height)
+	}
+	render()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	next := time.Now().Add(interval)
+	collecting := true
+	for !m.Quit() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			actx, cancel := context.WithTimeout(ctx, timeout)
+			m.HandleKey(actx, key)
+			cancel()
+		case errs := <-collected:
+			m.Sync(errs)
+			collecting = false
+			next = time.Now().Add(interval)
+		case <-ticker.C:
+			if !collecting && time.Now().After(next) {
+				collecting = true
+				go collect()
+			}
+		}
+		render()
+	}
+	return nil
+}
+
+// readKeys sends the keys read from r, until it fails.
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// parseKeys returns the keys pressed for the bytes of a single read from a terminal in
+// raw mode. A read of a lone escape is the escape key, rather than the start of a
+// sequence.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == 0x1b && (b[1] == '[' || b[1] == 'O'):
+			switch b[2] {
+			case 'A':
+				keys = append(keys, KeyUp)
+			case 'B':
+				keys = append(keys, KeyDown)
+			}
+			b = b[3:]
+			continue
+		case b[0] == 0x1b:
+			keys = append(keys, KeyEsc)
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, KeyEnter)
+		case b[0] == 3:
+			keys = append(keys, KeyCtrlC)
+		default:
+			keys = append(keys, string(b[0]))
+		}
+		b = b[1:]
+	}
+	return keys
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package top
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func makeRaw(fd int) (restore func(), err error) {
+	return nil, errors.Errorf("top is not supported on %s", runtime.GOOS)
+}
+
+func size(fd int) (width, height int) {
+	return 80, 24
+}
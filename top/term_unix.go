@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package top
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw puts the terminal fd into raw mode, in which keys are read as they are pressed,
+// without echo, and returns a function restoring its previous mode.
+func makeRaw(fd int) (restore func(), err error) {
+	var old syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, errors.Wrap(err, "top needs a terminal")
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, errors.Wrap(err, "setting terminal to raw mode")
+	}
+	return func() {
+		ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old))
+	}, nil
+}
+
+// size returns the width and height of the terminal fd, or 80x24 if they can't be read.
+func size(fd int) (width, height int) {
+	var ws struct{ rows, cols, x, y uint16 }
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil || ws.cols == 0 || ws.rows == 0 {
+		return 80, 24
+	}
+	return int(ws.cols), int(ws.rows)
+}
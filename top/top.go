@@ -0,0 +1,463 @@
+// Package top is an interactive terminal dashboard of kafka connect clusters. It lists
+// the connectors of every cluster, refreshed from the exporter's collection of their
+// state, highlights the connectors and tasks whose state changed recently, shows the
+// config and traces of a connector, and pauses, resumes and restarts connectors once
+// confirmed.
+//
+// The dashboard is a Model, updated with keys and collections, and rendered to a
+// terminal by Run.
+package top
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+)
+
+// Client is the part of the kafka connect REST API used by the dashboard, as implemented
+// by connectapi.Client.
+type Client interface {
+	prometheus.ConnectClient
+
+	PauseConnector(ctx context.Context, name string) error
+	ResumeConnector(ctx context.Context, name string) error
+	RestartConnector(ctx context.Context, name string, opts connectapi.RestartOptions) error
+}
+
+// Cluster is a cluster shown by the dashboard.
+type Cluster struct {
+	Name    string
+	client  Client
+	metrics *prometheus.Metrics
+}
+
+// NewCluster returns a cluster whose connectors are collected with client, as configured
+// by opts.
+func NewCluster(name string, client Client, opts prometheus.Opts) *Cluster {
+	opts.Cluster = name
+	return &Cluster{
+		Name:    name,
+		client:  client,
+		metrics: prometheus.NewMetricsWithOpts(client, opts),
+	}
+}
+
+// Keys handled by the dashboard, other than printable characters.
+const (
+	KeyUp    = "up"
+	KeyDown  = "down"
+	KeyEnter = "enter"
+	KeyEsc   = "esc"
+	KeyCtrlC = "ctrl+c"
+)
+
+// secretKey matches the config keys whose values are hidden.
+var secretKey = regexp.MustCompile(`(?i)password|secret|token|credentials|jaas`)
+
+// row is a connector listed by the dashboard.
+type row struct {
+	cluster *Cluster
+	conn    prometheus.ConnectorSnapshot
+}
+
+// id identifies the connector, prefixed by the name of its cluster, if it has one.
+func (r row) id() string {
+	if r.cluster.Name == "" {
+		return r.conn.Name
+	}
+	return r.cluster.Name + "/" + r.conn.Name
+}
+
+// action is a change to a connector, pending confirmation.
+type action struct {
+	verb string
+	row  row
+}
+
+// Model is the state of the dashboard.
+type Model struct {
+	clusters []*Cluster
+
+	// highlight is how long connectors and tasks are highlighted after changing state.
+	highlight time.Duration
+	now       func() time.Time
+
+	rows   []row
+	errs   map[*Cluster]error
+	first  map[*Cluster]time.Time
+	cursor int
+	offset int
+
+	// detail is the connector shown in detail, if any, along with its config.
+	detail    *row
+	config    connectapi.ConnectorConfig
+	configErr error
+
+	confirm *action
+	message string
+	quit    bool
+}
+
+// NewModel returns the dashboard of the clusters, refreshed every interval.
+func NewModel(clusters []*Cluster, interval time.Duration) *Model {
+	return &Model{
+		clusters:  clusters,
+		highlight: 3 * interval,
+		now:       time.Now,
+		errs:      make(map[*Cluster]error),
+		first:     make(map[*Cluster]time.Time),
+	}
+}
+
+// Collect updates the state of every cluster, and returns the errors of those which
+// failed. It only reads the clusters of the model, so it can run concurrently with
+// its other methods, after which Sync shows the new state.
+func (m *Model) Collect(ctx context.Context) map[*Cluster]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[*Cluster]error)
+	for _, c := range m.clusters {
+		wg.Add(1)
+		go func(c *Cluster) {
+			defer wg.Done()
+			if err := c.metrics.Update(ctx); err != nil {
+				mu.Lock()
+				errs[c] = err
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Sync lists the connectors of the last collection, along with its errors. The cursor
+// stays on the selected connector, if it is still listed.
+func (m *Model) Sync(errs map[*Cluster]error) {
+	var selected string
+	if m.cursor < len(m.rows) {
+		selected = m.rows[m.cursor].id()
+	}
+	m.errs = errs
+	m.rows = nil
+	for _, c := range m.clusters {
+		snap := c.metrics.Snapshot()
+		if _, ok := m.first[c]; !ok && !snap.CollectedAt.IsZero() {
+			m.first[c] = snap.CollectedAt
+		}
+		for _, conn := range snap.Connectors {
+			m.rows = append(m.rows, row{c, conn})
+		}
+	}
+	for i, r := range m.rows {
+		if r.id() == selected {
+			m.cursor = i
+		}
+		if m.detail != nil && r.id() == m.detail.id() {
+			detail := r
+			m.detail = &detail
+		}
+	}
+	if m.cursor >= len(m.rows) {
+		m.cursor = len(m.rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// Quit reports whether the dashboard should exit.
+func (m *Model) Quit() bool {
+	return m.quit
+}
+
+// HandleKey updates the model for a key press. Confirmed actions, and the config of the
+// connector being drilled into, call the connect API with ctx.
+func (m *Model) HandleKey(ctx context.Context, key string) {
+	if key == KeyCtrlC {
+		m.quit = true
+		return
+	}
+	if m.confirm != nil {
+		a := m.confirm
+		m.confirm = nil
+		if key == "y" || key == "Y" {
+			m.apply(ctx, a)
+		} else {
+			m.message = "cancelled"
+		}
+		return
+	}
+
+	m.message = ""
+	switch key {
+	case "q":
+		if m.detail == nil {
+			m.quit = true
+		}
+		m.detail = nil
+	case KeyEsc:
+		m.detail = nil
+	case KeyUp, "k":
+		if m.detail == nil && m.cursor > 0 {
+			m.cursor--
+		}
+	case KeyDown, "j":
+		if m.detail == nil && m.cursor < len(m.rows)-1 {
+			m.cursor++
+		}
+	case KeyEnter:
+		if r, ok := m.selected(); ok {
+			m.detail = &r
+			m.config, m.configErr = r.cluster.client.GetConnectorConfig(ctx, r.conn.Name)
+		}
+	case "p", "u", "r":
+		if r, ok := m.selected(); ok {
+			verb := map[string]string{"p": "pause", "u": "resume", "r": "restart"}[key]
+			m.confirm = &action{verb, r}
+		}
+	}
+}
+
+func (m *Model) selected() (row, bool) {
+	if m.detail != nil {
+		return *m.detail, true
+	}
+	if m.cursor < len(m.rows) {
+		return m.rows[m.cursor], true
+	}
+	return row{}, false
+}
+
+// apply calls the connect API for a confirmed action. Restarts include the failed tasks
+// of the connector, where the cluster supports it.
+func (m *Model) apply(ctx context.Context, a *action) {
+	client, name := a.row.cluster.client, a.row.conn.Name
+	var err error
+	switch a.verb {
+	case "pause":
+		err = client.PauseConnector(ctx, name)
+	case "resume":
+		err = client.ResumeConnector(ctx, name)
+	case "restart":
+		err = client.RestartConnector(ctx, name, connectapi.RestartOptions{IncludeTasks: true, OnlyFailed: true})
+		if connectapi.IsUnsupported(err) {
+			err = client.RestartConnector(ctx, name, connectapi.RestartOptions{})
+		}
+	}
+	if err != nil {
+		m.message = fmt.Sprintf("%s %s failed: %s", a.verb, a.row.id(), err)
+		return
+	}
+	m.message = fmt.Sprintf("%s %s requested", a.verb, a.row.id())
+}
+
+// changed reports whether the state of a connector or task of the cluster, first seen in
+// it at since, changed recently. Nothing has changed in the first collection.
+func (m *Model) changed(c *Cluster, since time.Time) bool {
+	return since.After(m.first[c]) && m.now().Sub(since) < m.highlight
+}
+
+// ANSI escape sequences used to render the dashboard.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reverse     = "\x1b[7m"
+	bold        = "\x1b[1m"
+	red         = "\x1b[31m"
+	yellow      = "\x1b[33m"
+	reset       = "\x1b[0m"
+)
+
+// Render draws the dashboard on a terminal of the given size.
+func (m *Model) Render(w io.Writer, width, height int) {
+	var lines []string
+	if m.detail != nil {
+		lines = m.renderDetail()
+	} else {
+		lines = m.renderList(height)
+	}
+
+	footer := "↑/↓ select  enter details  p pause  u resume  r restart  q quit"
+	if m.detail != nil {
+		footer = "p pause  u resume  r restart  esc back"
+	}
+	if m.confirm != nil {
+		footer = fmt.Sprintf("%s%s %s? [y/N]%s", bold, m.confirm.verb, m.confirm.row.id(), reset)
+	} else if m.message != "" {
+		footer = m.message
+	}
+
+	fmt.Fprint(w, clearScreen)
+	for i, line := range lines {
+		if i >= height-1 {
+			break
+		}
+		fmt.Fprint(w, fit(line, width), "\r\n")
+	}
+	fmt.Fprint(w, fit(footer, width))
+}
+
+func (m *Model) renderList(height int) []string {
+	lines := []string{m.header()}
+	for _, c := range m.clusters {
+		if err := m.errs[c]; err != nil {
+			lines = append(lines, fmt.Sprintf("%s%s: %s%s", red, name(c), err, reset))
+		}
+	}
+	lines = append(lines, bold+fmt.Sprintf("%-12s %-32s %-12s %-7s %s", "CLUSTER", "CONNECTOR", "STATE", "TASKS", "WORKER")+reset)
+
+	// scroll so that the cursor is visible.
+	visible := height - len(lines) - 1
+	if visible < 1 {
+		visible = 1
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+visible {
+		m.offset = m.cursor - visible + 1
+	}
+
+	for i := m.offset; i < len(m.rows) && i < m.offset+visible; i++ {
+		r := m.rows[i]
+		var running int
+		changed := m.changed(r.cluster, r.conn.Since)
+		failed := r.conn.State == connectapi.StateFailed
+		for _, t := range r.conn.Tasks {
+			if t.State == connectapi.StateRunning {
+				running++
+			}
+			changed = changed || m.changed(r.cluster, t.Since)
+			failed = failed || t.State == connectapi.StateFailed
+		}
+		line := fmt.Sprintf("%-12s %-32s %-12s %-7s %s", name(r.cluster), r.conn.Name, r.conn.State,
+			fmt.Sprintf("%d/%d", running, len(r.conn.Tasks)), r.conn.WorkerID)
+		switch {
+		case i == m.cursor:
+			line = reverse + line + reset
+		case changed:
+			line = yellow + line + reset
+		case failed:
+			line = red + line + reset
+		}
+		lines = append(lines, line)
+	}
+	if len(m.rows) == 0 {
+		lines = append(lines, "no connectors")
+	}
+	return lines
+}
+
+func (m *Model) header() string {
+	var conns, tasks, failed int
+	for _, r := range m.rows {
+		conns++
+		for _, t := range r.conn.Tasks {
+			tasks++
+			if t.State == connectapi.StateFailed {
+				failed++
+			}
+		}
+	}
+	return fmt.Sprintf("%skafka connect top%s  %s  %d connectors, %d tasks, %d failed",
+		bold, reset, m.now().Format("15:04:05"), conns, tasks, failed)
+}
+
+func (m *Model) renderDetail() []string {
+	r := m.detail
+	c := r.conn
+	lines := []string{
+		fmt.Sprintf("%s%s%s in %s", bold, c.Name, reset, name(r.cluster)),
+		fmt.Sprintf("type: %s  state: %s  worker: %s  since: %s", c.Type, m.state(r.cluster, c.State, c.Since), c.WorkerID, c.Since.Format(time.RFC3339)),
+	}
+	if md := c.Metadata; md != nil {
+		lines = append(lines, fmt.Sprintf("owner: %s  tier: %s  runbook: %s  slack: %s", md.Owner, md.Tier, md.RunbookURL, md.SlackChannel))
+	}
+	lines = append(lines, traceLines("connector trace", c.Trace)...)
+
+	lines = append(lines, "", bold+"TASKS"+reset)
+	for _, t := range c.Tasks {
+		lines = append(lines, fmt.Sprintf("  %d  %s  %s  since %s", t.ID, m.state(r.cluster, t.State, t.Since), t.WorkerID, t.Since.Format(time.RFC3339)))
+		lines = append(lines, traceLines(fmt.Sprintf("task %d trace", t.ID), t.Trace)...)
+	}
+
+	lines = append(lines, "", bold+"CONFIG"+reset)
+	if m.configErr != nil {
+		lines = append(lines, red+m.configErr.Error()+reset)
+	}
+	keys := make([]string, 0, len(m.config))
+	for k := range m.config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m.config[k]
+		if secretKey.MatchString(k) {
+			v = "REDACTED"
+		}
+		lines = append(lines, fmt.Sprintf("  %s = %s", k, v))
+	}
+	return lines
+}
+
+// state returns the state, colored if it has failed or changed recently.
+func (m *Model) state(c *Cluster, state string, since time.Time) string {
+	switch {
+	case m.changed(c, since):
+		return yellow + state + reset
+	case state == connectapi.StateFailed:
+		return red + state + reset
+	}
+	return state
+}
+
+func traceLines(title, trace string) []string {
+	if trace == "" {
+		return nil
+	}
+	lines := []string{"  " + red + title + ":" + reset}
+	for _, line := range strings.Split(strings.TrimRight(trace, "\n"), "\n") {
+		lines = append(lines, "    "+strings.Replace(line, "\t", "  ", -1))
+	}
+	return lines
+}
+
+func name(c *Cluster) string {
+	if c.Name == "" {
+		return "-"
+	}
+	return c.Name
+}
+
+// fit cuts line to width printable characters, ignoring escape sequences.
+func fit(line string, width int) string {
+	var b strings.Builder
+	n, escape := 0, false
+	for _, r := range line {
+		switch {
+		case r == '\x1b':
+			escape = true
+		case escape:
+			escape = !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			b.WriteRune(r)
+			continue
+		case n >= width:
+			continue
+		default:
+			n++
+		}
+		b.WriteRune(r)
+	}
+	if strings.Contains(line, "\x1b") {
+		b.WriteString(reset)
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package top_test
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/connectapi"
+	"github.com/autotraderuk/kafka-connect-exporter/prometheus"
+	"github.com/autotraderuk/kafka-connect-exporter/top"
+)
+
+// fakeClient is a kafka connect cluster whose connectors are paused, resumed and
+// restarted by the actions it receives.
+type fakeClient struct {
+	statuses map[string]*connectapi.ConnectorStatus
+	actions  []string
+
+	// unsupported restarts with options, as clusters older than 3.0 do.
+	unsupported bool
+}
+
+func (c *fakeClient) ListConnectors(ctx context.Context) ([]string, error) {
+	var names []string
+	for name := range c.statuses {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (c *fakeClient) GetConnectorStatus(ctx context.Context, name string) (*connectapi.ConnectorStatus, error) {
+	status, ok := c.statuses[name]
+	if !ok {
+		return nil, &connectapi.APIError{StatusCode: 404}
+	}
+	return status, nil
+}
+
+func (c *fakeClient) GetConnectorConfig(ctx context.Context, name string) (connectapi.ConnectorConfig, error) {
+	return connectapi.ConnectorConfig{"topics": name, "database.password": "hunter2"}, nil
+}
+
+func (c *fakeClient) setState(name, state string) {
+	status := *c.statuses[name]
+	status.Connector.State = state
+	c.statuses[name] = &status
+}
+
+func (c *fakeClient) PauseConnector(ctx context.Context, name string) error {
+	c.actions = append(c.actions, "pause "+name)
+	c.setState(name, connectapi.StatePaused)
+	return nil
+}
+
+func (c *fakeClient) ResumeConnector(ctx context.Context, name string) error {
+	c.actions = append(c.actions, "resume "+name)
+	c.setState(name, connectapi.StateRunning)
+	return nil
+}
+
+func (c *fakeClient) RestartConnector(ctx context.Context, name string, opts connectapi.RestartOptions) error {
+	if opts != (connectapi.RestartOptions{}) && c.unsupported {
+		return &connectapi.UnsupportedError{Endpoint: "restart with options"}
+	}
+	c.actions = append(c.actions, "restart "+name)
+	return nil
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{statuses: map[string]*connectapi.ConnectorStatus{
+		"orders": {
+			Name:      "orders",
+			Connector: connectapi.ConnectorState{State: connectapi.StateRunning, WorkerID: "w1:8083"},
+			Tasks: []connectapi.TaskState{
+				{ID: 0, State: connectapi.StateRunning, WorkerID: "w1:8083"},
+				{ID: 1, State: connectapi.StateFailed, WorkerID: "w2:8083", Trace: "java.lang.Exception: boom\n\tat Task.poll"},
+			},
+		},
+		"users": {
+			Name:      "users",
+			Connector: connectapi.ConnectorState{State: connectapi.StateRunning, WorkerID: "w2:8083"},
+			Tasks:     []connectapi.TaskState{{ID: 0, State: connectapi.StateRunning, WorkerID: "w2:8083"}},
+		},
+	}}
+}
+
+func render(m *top.Model) string {
+	var buf bytes.Buffer
+	m.Render(&buf, 120, 40)
+	return buf.String()
+}
+
+// refresh collects the clusters of the model, and shows their new state.
+func refresh(t *testing.T, m *top.Model) {
+	errs := m.Collect(context.Background())
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	m.Sync(errs)
+}
+
+func TestModel(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	m := top.NewModel([]*top.Cluster{top.NewCluster("prod", client, prometheus.Opts{})}, time.Minute)
+	refresh(t, m)
+
+	screen := render(m)
+	for _, expect := range []string{"2 connectors, 3 tasks, 1 failed", "orders", "users", "1/2"} {
+		if !strings.Contains(screen, expect) {
+			t.Errorf("expected the list to contain %q:\n%s", expect, screen)
+		}
+	}
+
+	// drill into the second connector, and back out.
+	m.HandleKey(ctx, top.KeyDown)
+	m.HandleKey(ctx, top.KeyEnter)
+	screen = render(m)
+	if !strings.Contains(screen, "users") || !strings.Contains(screen, "topics = users") {
+		t.Errorf("expected the details of users:\n%s", screen)
+	}
+	if strings.Contains(screen, "hunter2") {
+		t.Errorf("expected secrets to be redacted:\n%s", screen)
+	}
+	m.HandleKey(ctx, top.KeyEsc)
+	m.HandleKey(ctx, top.KeyUp)
+	m.HandleKey(ctx, top.KeyEnter)
+	screen = render(m)
+	if !strings.Contains(screen, "task 1 trace") || !strings.Contains(screen, "java.lang.Exception: boom") {
+		t.Errorf("expected the trace of the failed task:\n%s", screen)
+	}
+
+	// actions only apply once confirmed.
+	m.HandleKey(ctx, "p")
+	if screen := render(m); !strings.Contains(screen, "pause prod/orders? [y/N]") {
+		t.Errorf("expected a confirmation prompt:\n%s", screen)
+	}
+	m.HandleKey(ctx, "n")
+	if len(client.actions) != 0 {
+		t.Errorf("expected no action once cancelled, got %v", client.actions)
+	}
+	m.HandleKey(ctx, "p")
+	m.HandleKey(ctx, "y")
+	if !reflect.DeepEqual(client.actions, []string{"pause orders"}) {
+		t.Errorf("unexpected actions %v", client.actions)
+	}
+
+	// the paused connector is highlighted as changed once refreshed.
+	refresh(t, m)
+	m.HandleKey(ctx, top.KeyEsc)
+	m.HandleKey(ctx, top.KeyDown)
+	screen = render(m)
+	if !strings.Contains(screen, "\x1b[33mprod") || !strings.Contains(screen, "PAUSED") {
+		t.Errorf("expected the paused connector to be highlighted:\n%q", screen)
+	}
+
+	m.HandleKey(ctx, "q")
+	if !m.Quit() {
+		t.Error("expected q to quit from the list")
+	}
+}
+
+func TestModelRestartFallback(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeClient()
+	client.unsupported = true
+	m := top.NewModel([]*top.Cluster{top.NewCluster("", client, prometheus.Opts{})}, time.Minute)
+	refresh(t, m)
+
+	m.HandleKey(ctx, "r")
+	m.HandleKey(ctx, "y")
+	if !reflect.DeepEqual(client.actions, []string{"restart orders"}) {
+		t.Errorf("expected a plain restart, got %v", client.actions)
+	}
+	if screen := render(m); !strings.Contains(screen, "restart orders requested") {
+		t.Errorf("expected the restart to be reported:\n%s", screen)
+	}
+}
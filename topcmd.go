@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/top"
+)
+
+// runTop runs the top subcommand: an interactive dashboard of every configured cluster,
+// collected the same way as the metrics. It returns the exit status.
+func runTop(args []string) int {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	loader := loaderFlags(flags)
+	interval := flags.Duration("interval", 0, "time between refreshes, defaults to the poll interval")
+	timeout := flags.Duration("timeout", 10*time.Second, "time allowed for pausing, resuming and restarting connectors")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx := context.Background()
+	cfg, err := loader.Load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	opts, err := cfg.MetricsOpts()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *interval <= 0 {
+		*interval = time.Duration(cfg.Connect.PollInterval) * time.Second
+	}
+
+	var clusters []*top.Cluster
+	for _, c := range cfg.Clusters() {
+		client, _, err := newClient(cfg, c.Host)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		clusters = append(clusters, top.NewCluster(c.Name, client, opts))
+	}
+
+	m := top.NewModel(clusters, *interval)
+	if err := top.Run(ctx, os.Stdin, os.Stdout, m, *interval, *timeout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
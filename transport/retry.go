@@ -0,0 +1,183 @@
+// Package transport provides the HTTP transport used for calls to the kafka connect REST
+// API.
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults used by a zero Retry.
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Reasons for retrying a request, as passed to Retry.OnRetry.
+const (
+	ReasonError   = "error"
+	ReasonTimeout = "timeout"
+)
+
+// Retry is an http.RoundTripper retrying idempotent requests which fail with a transport
+// error, a timeout, or a status code indicating a transient failure: 409 (a rebalance is in
+// progress), 429, 502, 503 and 504. Retries are spaced by a jittered exponential backoff.
+type Retry struct {
+	// Base is the transport used for each attempt. It defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// MaxRetries is the number of times a request is retried. Zero means
+	// DefaultMaxRetries, and a negative value disables retries.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the time between attempts, which doubles after each
+	// attempt. They default to DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the time allowed for each attempt, including reading the response body.
+	// It defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// OnRetry, if set, is called before each retry with the reason for it: ReasonError,
+	// ReasonTimeout or the status code of the failed attempt.
+	OnRetry func(req *http.Request, reason string)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Retry) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := t.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+	if !replayable(req) {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := t.attempt(req)
+		reason := retryReason(req, res, err)
+		if reason == "" || attempt >= retries {
+			return res, err
+		}
+		if res != nil {
+			drain(res.Body)
+		}
+		if t.OnRetry != nil {
+			t.OnRetry(req, reason)
+		}
+
+		timer := time.NewTimer(t.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once, cancelling it if the response hasn't been read within
+// the timeout.
+func (t *Retry) attempt(req *http.Request) (*http.Response, error) {
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	req = req.WithContext(ctx)
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// backoff returns the time to wait after the given attempt, starting at 0: a random
+// duration between half and all of the exponential backoff.
+func (t *Retry) backoff(attempt int) time.Duration {
+	min, max := t.MinBackoff, t.MaxBackoff
+	if min == 0 {
+		min = DefaultMinBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// replayable reports whether the request is idempotent, and can be sent again.
+func replayable(req *http.Request) bool {
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryReason returns why the attempt should be retried, or an empty string if it
+// shouldn't.
+func retryReason(req *http.Request, res *http.Response, err error) string {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return ""
+		}
+		if e, ok := err.(interface{ Timeout() bool }); ok && e.Timeout() {
+			return ReasonTimeout
+		}
+		return ReasonError
+	}
+	switch res.StatusCode {
+	case http.StatusConflict, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return strconv.Itoa(res.StatusCode)
+	}
+	return ""
+}
+
+// drain reads and closes a response body, so that the connection can be reused.
+func drain(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, 64<<10))
+	body.Close()
+}
+
+// cancelBody releases the context of an attempt once its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
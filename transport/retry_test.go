@@ -0,0 +1,139 @@
+package transport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/autotraderuk/kafka-connect-exporter/transport"
+)
+
+type retryTestCase struct {
+	name   string
+	method string
+
+	// responses are the status codes returned by the server for each attempt. A zero
+	// status code makes the server hang past the timeout.
+	responses []int
+
+	expectStatus   int
+	expectErr      bool
+	expectAttempts int
+	expectReasons  []string
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []retryTestCase{
+		{
+			name:           "success",
+			method:         "GET",
+			responses:      []int{200},
+			expectStatus:   200,
+			expectAttempts: 1,
+		},
+		{
+			name:           "rebalance in progress",
+			method:         "GET",
+			responses:      []int{409, 503, 200},
+			expectStatus:   200,
+			expectAttempts: 3,
+			expectReasons:  []string{"409", "503"},
+		},
+		{
+			name:           "retries exhausted",
+			method:         "GET",
+			responses:      []int{503, 503, 503},
+			expectStatus:   503,
+			expectAttempts: 3,
+			expectReasons:  []string{"503", "503"},
+		},
+		{
+			name:           "client error",
+			method:         "GET",
+			responses:      []int{404},
+			expectStatus:   404,
+			expectAttempts: 1,
+		},
+		{
+			name:           "timeout",
+			method:         "GET",
+			responses:      []int{0, 200},
+			expectStatus:   200,
+			expectAttempts: 2,
+			expectReasons:  []string{transport.ReasonTimeout},
+		},
+		{
+			name:           "not idempotent",
+			method:         "POST",
+			responses:      []int{409},
+			expectStatus:   409,
+			expectAttempts: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, tc.assert)
+	}
+}
+
+func (tc retryTestCase) assert(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		reasons  []string
+	)
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		status := tc.responses[attempts]
+		attempts++
+		mu.Unlock()
+		if status == 0 {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	defer close(done) // releases hanging handlers before the server is closed
+
+	client := &http.Client{Transport: &transport.Retry{
+		MaxRetries: 2,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+		Timeout:    50 * time.Millisecond,
+		OnRetry: func(_ *http.Request, reason string) {
+			reasons = append(reasons, reason)
+		},
+	}}
+	req, err := http.NewRequest(tc.method, srv.URL, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if !tc.expectErr {
+			t.Fatal(err)
+		}
+	} else {
+		res.Body.Close()
+		if res.StatusCode != tc.expectStatus {
+			t.Errorf("expected status %d, got %d", tc.expectStatus, res.StatusCode)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != tc.expectAttempts {
+		t.Errorf("expected %d attempts, got %d", tc.expectAttempts, attempts)
+	}
+	if strings.Join(reasons, ",") != strings.Join(tc.expectReasons, ",") {
+		t.Errorf("expected retry reasons %v, got %v", tc.expectReasons, reasons)
+	}
+}